@@ -3,6 +3,7 @@
 // and generates cluster-specific directories under apps/clusters/ for ApplicationSet to discover.
 //
 // Usage: go run scripts/generate-cluster-apps.go
+//        go run scripts/generate-cluster-apps.go -dry-run   # print a diff, exit 1 on drift
 //
 // The script is idempotent and safe to run multiple times.
 // It removes stale directories for apps that no longer target a cluster.
@@ -10,6 +11,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -21,12 +23,15 @@ import (
 
 // AppConfig represents the structure of app-config.yaml
 type AppConfig struct {
-	TargetClusters []string `yaml:"targetClusters"`
+	TargetClusters []string                          `yaml:"targetClusters"`
+	Values         map[string]interface{}            `yaml:"values"`
+	ClusterValues  map[string]map[string]interface{} `yaml:"clusterValues"`
 }
 
 // GeneratedConfig represents the generated app-config.yaml for clusters
 type GeneratedConfig struct {
-	ChartPath string `yaml:"chartPath"`
+	ChartPath string                 `yaml:"chartPath"`
+	Values    map[string]interface{} `yaml:"values,omitempty"`
 }
 
 // AppInfo holds information about a discovered app
@@ -35,9 +40,148 @@ type AppInfo struct {
 	Type           string // "workloads" or "infra"
 	SourcePath     string // e.g., "apps/workloads/simple-echo-server"
 	TargetClusters []string
+	Values         map[string]interface{}
+	ClusterValues  map[string]map[string]interface{}
+}
+
+// fsOp abstracts the filesystem mutations this script makes, so a dry-run
+// mode can compute what would change without touching disk.
+type fsOp interface {
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+	RemoveAll(path string) error
+	Remove(path string) error
+}
+
+// applyFsOp performs filesystem mutations for real.
+type applyFsOp struct{}
+
+func (applyFsOp) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+func (applyFsOp) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (applyFsOp) RemoveAll(path string) error                  { return os.RemoveAll(path) }
+func (applyFsOp) Remove(path string) error                     { return os.Remove(path) }
+
+// planFsOp records what would change instead of touching disk, printing a
+// unified diff per file and tracking whether anything changed.
+type planFsOp struct {
+	changed bool
+}
+
+func (p *planFsOp) WriteFile(path string, data []byte, perm os.FileMode) error {
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		existing = nil
+	}
+	if string(existing) == string(data) {
+		return nil
+	}
+	p.changed = true
+	fmt.Print(unifiedDiff(path, existing, data))
+	return nil
+}
+
+func (p *planFsOp) MkdirAll(path string, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	p.changed = true
+	fmt.Printf("would create directory %s\n", path)
+	return nil
+}
+
+func (p *planFsOp) RemoveAll(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	p.changed = true
+	fmt.Printf("would remove %s\n", path)
+	return nil
+}
+
+func (p *planFsOp) Remove(path string) error {
+	return p.RemoveAll(path)
+}
+
+// unifiedDiff renders a line-based unified diff between oldContent (nil if
+// the file doesn't exist yet) and newContent.
+func unifiedDiff(path string, oldContent, newContent []byte) string {
+	oldLines := strings.Split(string(oldContent), "\n")
+	newLines := strings.Split(string(newContent), "\n")
+	lcs := lcsLines(oldLines, newLines)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", path, path)
+	oi, ni, li := 0, 0, 0
+	for oi < len(oldLines) || ni < len(newLines) {
+		switch {
+		case li < len(lcs) && oi < len(oldLines) && ni < len(newLines) && oldLines[oi] == lcs[li] && newLines[ni] == lcs[li]:
+			fmt.Fprintf(&b, " %s\n", oldLines[oi])
+			oi++
+			ni++
+			li++
+		case oi < len(oldLines) && (li >= len(lcs) || oldLines[oi] != lcs[li]):
+			fmt.Fprintf(&b, "-%s\n", oldLines[oi])
+			oi++
+		default:
+			fmt.Fprintf(&b, "+%s\n", newLines[ni])
+			ni++
+		}
+	}
+	return b.String()
+}
+
+// lcsLines returns the longest common subsequence of two line slices.
+func lcsLines(a, b []string) []string {
+	n, m := len(a), len(b)
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] >= dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	var lcs []string
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			lcs = append(lcs, a[i])
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return lcs
 }
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "compute changes without writing to disk, printing a diff; exit 1 if the tree would change")
+	diffOnly := flag.Bool("diff", false, "alias for -dry-run")
+	flag.Parse()
+
+	var fs fsOp = applyFsOp{}
+	plan := &planFsOp{}
+	if *dryRun || *diffOnly {
+		fs = plan
+	}
+
 	// Find the repo root (where apps/ directory exists)
 	repoRoot, err := findRepoRoot()
 	if err != nil {
@@ -61,17 +205,26 @@ func main() {
 
 	// Generate cluster directories
 	clustersDir := filepath.Join(repoRoot, "apps", "clusters")
-	if err := generateClusterDirs(clustersDir, apps); err != nil {
+	if err := generateClusterDirs(fs, clustersDir, apps); err != nil {
 		fmt.Fprintf(os.Stderr, "Error generating cluster directories: %v\n", err)
 		os.Exit(1)
 	}
 
 	// Clean up stale directories
-	if err := cleanupStaleDirs(clustersDir, expectedStructure); err != nil {
+	if err := cleanupStaleDirs(fs, clustersDir, expectedStructure); err != nil {
 		fmt.Fprintf(os.Stderr, "Error cleaning up stale directories: %v\n", err)
 		os.Exit(1)
 	}
 
+	if *dryRun || *diffOnly {
+		if plan.changed {
+			fmt.Println("\nTree is out of date.")
+			os.Exit(1)
+		}
+		fmt.Println("\nTree is up to date.")
+		return
+	}
+
 	fmt.Println("Done!")
 }
 
@@ -160,6 +313,8 @@ func discoverAppsInDir(repoRoot, appType string) ([]AppInfo, error) {
 			Type:           appType,
 			SourcePath:     filepath.Join("apps", appType, appName),
 			TargetClusters: config.TargetClusters,
+			Values:         config.Values,
+			ClusterValues:  config.ClusterValues,
 		})
 
 		fmt.Printf("  Found %s/%s targeting %v\n", appType, appName, config.TargetClusters)
@@ -183,6 +338,95 @@ func readAppConfig(path string) (*AppConfig, error) {
 	return &config, nil
 }
 
+// mergeClusterValues merges an app's default values with a cluster's
+// overrides, with cluster-specific values taking precedence. Neither input
+// map is mutated.
+func mergeClusterValues(defaults map[string]interface{}, overrides map[string]interface{}) map[string]interface{} {
+	if len(defaults) == 0 && len(overrides) == 0 {
+		return nil
+	}
+
+	merged := make(map[string]interface{}, len(defaults)+len(overrides))
+	for k, v := range defaults {
+		merged[k] = v
+	}
+	for k, v := range overrides {
+		merged[k] = v
+	}
+	return merged
+}
+
+// interpolateValues substitutes {{cluster}}, {{type}}, {{app}}, and
+// {{values.<key>}} tokens in string values, in place. It's a single
+// whitelisted pass over a snapshot of the merged map: a token only resolves
+// if the key it references is already present in that snapshot, so
+// references can't chain into further expansion and there's no risk of
+// runaway (billion-laughs-style) substitution.
+func interpolateValues(values map[string]interface{}, cluster, appType, appName string) {
+	if len(values) == 0 {
+		return
+	}
+
+	snapshot := make(map[string]interface{}, len(values))
+	for k, v := range values {
+		snapshot[k] = v
+	}
+
+	replacer := func(token string) (string, bool) {
+		switch {
+		case token == "cluster":
+			return cluster, true
+		case token == "type":
+			return appType, true
+		case token == "app":
+			return appName, true
+		case strings.HasPrefix(token, "values."):
+			key := strings.TrimPrefix(token, "values.")
+			if v, ok := snapshot[key]; ok {
+				return fmt.Sprintf("%v", v), true
+			}
+		}
+		return "", false
+	}
+
+	for k, v := range values {
+		s, ok := v.(string)
+		if !ok {
+			continue
+		}
+		values[k] = interpolateTokens(s, replacer)
+	}
+}
+
+// interpolateTokens replaces each {{token}} in s using resolve. Tokens that
+// don't resolve are left untouched.
+func interpolateTokens(s string, resolve func(token string) (string, bool)) string {
+	var out strings.Builder
+	for {
+		start := strings.Index(s, "{{")
+		if start == -1 {
+			out.WriteString(s)
+			break
+		}
+		end := strings.Index(s[start:], "}}")
+		if end == -1 {
+			out.WriteString(s)
+			break
+		}
+		end += start
+
+		out.WriteString(s[:start])
+		token := strings.TrimSpace(s[start+2 : end])
+		if replacement, ok := resolve(token); ok {
+			out.WriteString(replacement)
+		} else {
+			out.WriteString(s[start : end+2])
+		}
+		s = s[end+2:]
+	}
+	return out.String()
+}
+
 // buildExpectedStructure builds a map of cluster -> type -> app -> true
 func buildExpectedStructure(apps []AppInfo) map[string]map[string]map[string]bool {
 	structure := make(map[string]map[string]map[string]bool)
@@ -203,20 +447,23 @@ func buildExpectedStructure(apps []AppInfo) map[string]map[string]map[string]boo
 }
 
 // generateClusterDirs creates the cluster-specific directories and app-config.yaml files
-func generateClusterDirs(clustersDir string, apps []AppInfo) error {
+func generateClusterDirs(fs fsOp, clustersDir string, apps []AppInfo) error {
 	for _, app := range apps {
 		for _, cluster := range app.TargetClusters {
 			appDir := filepath.Join(clustersDir, cluster, app.Type, app.Name)
 
 			// Create directory
-			if err := os.MkdirAll(appDir, 0755); err != nil {
+			if err := fs.MkdirAll(appDir, 0755); err != nil {
 				return fmt.Errorf("creating %s: %w", appDir, err)
 			}
 
 			// Generate app-config.yaml
 			configPath := filepath.Join(appDir, "app-config.yaml")
+			mergedValues := mergeClusterValues(app.Values, app.ClusterValues[cluster])
+			interpolateValues(mergedValues, cluster, app.Type, app.Name)
 			config := GeneratedConfig{
 				ChartPath: app.SourcePath,
+				Values:    mergedValues,
 			}
 
 			data, err := yaml.Marshal(&config)
@@ -227,7 +474,7 @@ func generateClusterDirs(clustersDir string, apps []AppInfo) error {
 			// Add header comment
 			content := fmt.Sprintf("# GENERATED - DO NOT EDIT\n# Source: %s/app-config.yaml\n# Run 'go run scripts/generate-cluster-apps.go' to regenerate\n%s", app.SourcePath, string(data))
 
-			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			if err := fs.WriteFile(configPath, []byte(content), 0644); err != nil {
 				return fmt.Errorf("writing %s: %w", configPath, err)
 			}
 
@@ -238,8 +485,13 @@ func generateClusterDirs(clustersDir string, apps []AppInfo) error {
 	return nil
 }
 
-// cleanupStaleDirs removes directories that should no longer exist
-func cleanupStaleDirs(clustersDir string, expected map[string]map[string]map[string]bool) error {
+// cleanupStaleDirs removes directories that should no longer exist.
+// Directory membership is keyed entirely off TargetClusters (via
+// expectedStructure), so dropping a cluster from clusterValues never leaves
+// a stale directory behind on its own - it only changes the content written
+// for clusters the app still targets. Removing the cluster from
+// targetClusters is what triggers removal here.
+func cleanupStaleDirs(fs fsOp, clustersDir string, expected map[string]map[string]map[string]bool) error {
 	// Check if clusters directory exists
 	if _, err := os.Stat(clustersDir); os.IsNotExist(err) {
 		return nil
@@ -284,7 +536,7 @@ func cleanupStaleDirs(clustersDir string, expected map[string]map[string]map[str
 				if !shouldExist {
 					appDir := filepath.Join(typeDir, appName)
 					fmt.Printf("  Removing stale directory: %s\n", appDir)
-					if err := os.RemoveAll(appDir); err != nil {
+					if err := fs.RemoveAll(appDir); err != nil {
 						return fmt.Errorf("removing %s: %w", appDir, err)
 					}
 				}
@@ -293,7 +545,7 @@ func cleanupStaleDirs(clustersDir string, expected map[string]map[string]map[str
 			// Remove empty type directory
 			remaining, _ := os.ReadDir(typeDir)
 			if len(remaining) == 0 {
-				os.Remove(typeDir)
+				fs.Remove(typeDir)
 			}
 		}
 
@@ -301,7 +553,7 @@ func cleanupStaleDirs(clustersDir string, expected map[string]map[string]map[str
 		clusterDir := filepath.Join(clustersDir, cluster)
 		remaining, _ := os.ReadDir(clusterDir)
 		if len(remaining) == 0 {
-			os.Remove(clusterDir)
+			fs.Remove(clusterDir)
 		}
 	}
 
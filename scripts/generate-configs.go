@@ -2,22 +2,38 @@
 // This script reads app-config.yaml files from apps/workloads/ and apps/infra/,
 // and generates:
 //   1. Cluster-specific directories under apps/clusters/ for ApplicationSet to discover
-//   2. Kargo resources (Project, Warehouse, Stages) under apps/kargo-configs/
+//   2. ApplicationSet resources under apps/applicationsets/ that consume those directories
+//   3. Kargo resources (Project, Warehouse, Stages) under apps/kargo-configs/
 //
 // Usage: go run scripts/generate-configs.go
+//        go run scripts/generate-configs.go -dirs-only            # skip ApplicationSet generation
+//        go run scripts/generate-configs.go -applicationset-only  # skip the apps/clusters/ directory tree
+//        go run scripts/generate-configs.go -dry-run              # print a diff, exit 1 on drift, write nothing
+//        go run scripts/generate-configs.go -validate             # validate manifests, aggregating errors in -dry-run
 //
 // The script is idempotent and safe to run multiple times.
 // It regenerates all manifests on each run and removes stale directories.
 //
+// -validate checks every generated manifest has apiVersion/kind/metadata.name,
+// checks spec fields against the bundled CRD schemas under scripts/schemas/
+// (if a schema for that kind exists), and shells out to
+// `kubectl apply --dry-run=client` when KUBECONFIG is set. All three checks
+// are best-effort and skip silently when their prerequisite isn't available,
+// so -validate stays usable in an offline CI container.
+//
 // Environment variables:
 //   GIT_REPO_URL - Git repository URL (optional, reads from values-credentials.yaml if not set)
 
 package main
 
 import (
+	"bytes"
+	"flag"
 	"fmt"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"regexp"
 	"sort"
 	"strings"
 
@@ -30,12 +46,73 @@ var parallelStages = []string{"prod-us", "prod-eu", "prod-au", "infra"}
 
 // AppConfig represents the structure of app-config.yaml
 type AppConfig struct {
-	TargetClusters []string `yaml:"targetClusters"`
+	TargetClusters []string             `yaml:"targetClusters"`
+	PromotionGraph []PromotionGraphNode `yaml:"promotionGraph"`
+
+	// Namespace is the app's real Kubernetes deploy namespace. Defaults to
+	// the app name when empty, matching today's behavior.
+	Namespace string `yaml:"namespace"`
+	// ProjectNamespace is the Kargo Project's namespace (i.e. the Project's
+	// metadata.name, since Kargo Projects are namespace-shaped). Defaults to
+	// Namespace when empty, so a single-namespace app needs no extra config.
+	ProjectNamespace string `yaml:"projectNamespace"`
+	// AllowClusterScopedResources permits this app's promotions to manage
+	// cluster-scoped manifests. Defaults to true when unset; set to false to
+	// restrict a namespaced app to namespaced resources only.
+	AllowClusterScopedResources *bool `yaml:"allowClusterScopedResources"`
+
+	// Warehouse declares the Warehouse's subscriptions. When empty, the
+	// Warehouse falls back to today's single git subscription on SourcePath.
+	Warehouse []WarehouseSubscription `yaml:"warehouse"`
+}
+
+// WarehouseSubscription is one subscription entry in the warehouse: list.
+// Exactly one of Git, Chart, or Image must be set.
+type WarehouseSubscription struct {
+	Git   *GitSubscription   `yaml:"git"`
+	Chart *ChartSubscription `yaml:"chart"`
+	Image *ImageSubscription `yaml:"image"`
+}
+
+// GitSubscription is a git Warehouse subscription.
+type GitSubscription struct {
+	RepoURL      string   `yaml:"repoURL"`
+	Branch       string   `yaml:"branch"`
+	IncludePaths []string `yaml:"includePaths"`
+	ExcludePaths []string `yaml:"excludePaths"`
+}
+
+// ChartSubscription is a Helm chart Warehouse subscription.
+type ChartSubscription struct {
+	RepoURL          string `yaml:"repoURL"`
+	Name             string `yaml:"name"`
+	SemverConstraint string `yaml:"semverConstraint"`
+}
+
+// ImageSubscription is a container image Warehouse subscription.
+type ImageSubscription struct {
+	RepoURL          string `yaml:"repoURL"`
+	SemverConstraint string `yaml:"semverConstraint"`
+	TagRegex         string `yaml:"tagRegex"`
+	Platform         string `yaml:"platform"`
+}
+
+// PromotionGraphNode describes one stage in an app's own promotion topology.
+// An empty Upstreams means the stage pulls freight directly from the
+// Warehouse; more than one entry means the stage fans in from several
+// upstreams.
+type PromotionGraphNode struct {
+	Name      string   `yaml:"name"`
+	Cluster   string   `yaml:"cluster"`
+	Shard     string   `yaml:"shard"`
+	Upstreams []string `yaml:"upstreams"`
 }
 
 // GeneratedConfig represents the generated app-config.yaml for clusters
 type GeneratedConfig struct {
-	ChartPath string `yaml:"chartPath"`
+	ChartPath        string `yaml:"chartPath"`
+	Namespace        string `yaml:"namespace"`
+	ProjectNamespace string `yaml:"projectNamespace"`
 }
 
 // AppInfo holds information about a discovered app
@@ -44,6 +121,12 @@ type AppInfo struct {
 	Type           string // "workloads" or "infra"
 	SourcePath     string // e.g., "apps/workloads/simple-echo-server"
 	TargetClusters []string
+	PromotionGraph []PromotionGraphNode
+
+	Namespace                   string
+	ProjectNamespace            string
+	AllowClusterScopedResources bool
+	Warehouse                   []WarehouseSubscription
 }
 
 // CredentialsConfig represents the structure of values-credentials.yaml
@@ -51,15 +134,311 @@ type CredentialsConfig struct {
 	GitRepo struct {
 		URL string `yaml:"url"`
 	} `yaml:"gitRepo"`
+	ApplicationSet struct {
+		// Mode controls how ApplicationSet CRs are grouped: "perApp" (default,
+		// one ApplicationSet per type/app pair) or "perCluster" (one
+		// ApplicationSet per target cluster).
+		Mode string `yaml:"mode"`
+	} `yaml:"applicationSet"`
 }
 
 // StageInfo holds information about a stage
 type StageInfo struct {
-	Name     string
-	Upstream string // Empty means get from warehouse directly
+	Name      string
+	Shard     string   // Shard to run the promotion process on; empty falls back to the stage name (infra: the default shard)
+	Upstreams []string // Empty means get from warehouse directly; multiple means fan-in
+}
+
+// fsOp abstracts the filesystem mutations this script makes, so a dry-run
+// mode can compute what would change without touching disk.
+type fsOp interface {
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+	RemoveAll(path string) error
+	Remove(path string) error
+}
+
+// applyFsOp performs filesystem mutations for real.
+type applyFsOp struct{}
+
+func (applyFsOp) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+func (applyFsOp) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (applyFsOp) RemoveAll(path string) error                  { return os.RemoveAll(path) }
+func (applyFsOp) Remove(path string) error                     { return os.Remove(path) }
+
+// planFsOp records what would change instead of touching disk, printing a
+// unified diff per file and tracking whether anything changed.
+type planFsOp struct {
+	changed bool
+}
+
+func (p *planFsOp) WriteFile(path string, data []byte, perm os.FileMode) error {
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		existing = nil
+	}
+	if string(existing) == string(data) {
+		return nil
+	}
+	p.changed = true
+	fmt.Print(unifiedDiff(path, existing, data))
+	return nil
+}
+
+func (p *planFsOp) MkdirAll(path string, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	p.changed = true
+	fmt.Printf("would create directory %s\n", path)
+	return nil
+}
+
+func (p *planFsOp) RemoveAll(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	p.changed = true
+	fmt.Printf("would remove %s\n", path)
+	return nil
+}
+
+func (p *planFsOp) Remove(path string) error {
+	return p.RemoveAll(path)
+}
+
+// unifiedDiff renders a line-based unified diff between oldContent (nil if
+// the file doesn't exist yet) and newContent.
+func unifiedDiff(path string, oldContent, newContent []byte) string {
+	oldLines := strings.Split(string(oldContent), "\n")
+	newLines := strings.Split(string(newContent), "\n")
+	lcs := lcsLines(oldLines, newLines)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", path, path)
+	oi, ni, li := 0, 0, 0
+	for oi < len(oldLines) || ni < len(newLines) {
+		switch {
+		case li < len(lcs) && oi < len(oldLines) && ni < len(newLines) && oldLines[oi] == lcs[li] && newLines[ni] == lcs[li]:
+			fmt.Fprintf(&b, " %s\n", oldLines[oi])
+			oi++
+			ni++
+			li++
+		case oi < len(oldLines) && (li >= len(lcs) || oldLines[oi] != lcs[li]):
+			fmt.Fprintf(&b, "-%s\n", oldLines[oi])
+			oi++
+		default:
+			fmt.Fprintf(&b, "+%s\n", newLines[ni])
+			ni++
+		}
+	}
+	return b.String()
+}
+
+// lcsLines returns the longest common subsequence of two line slices.
+func lcsLines(a, b []string) []string {
+	n, m := len(a), len(b)
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] >= dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	var lcs []string
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			lcs = append(lcs, a[i])
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return lcs
+}
+
+// validatingFsOp wraps another fsOp, validating every manifest before it's
+// written. In aggregate mode (dry-run) every validation failure is recorded
+// into errs and the write still proceeds so the diff is complete; otherwise
+// the first failure is returned immediately, matching the script's existing
+// fail-fast behavior.
+type validatingFsOp struct {
+	fsOp
+	aggregate bool
+	errs      *[]error
+}
+
+func (v *validatingFsOp) WriteFile(path string, data []byte, perm os.FileMode) error {
+	if errs := validateManifest(path, data); len(errs) > 0 {
+		if v.aggregate {
+			*v.errs = append(*v.errs, errs...)
+		} else {
+			return errs[0]
+		}
+	}
+	return v.fsOp.WriteFile(path, data, perm)
+}
+
+// validateManifest runs structural and (best-effort) schema validation
+// against a generated manifest file, which may contain multiple "---"
+// separated YAML documents. It never panics on missing tooling: kubectl and
+// scripts/schemas/ are both optional.
+func validateManifest(path string, data []byte) []error {
+	var errs []error
+
+	for i, doc := range strings.Split(string(data), "\n---\n") {
+		doc = strings.TrimSpace(doc)
+		if doc == "" {
+			continue
+		}
+
+		var parsed struct {
+			APIVersion string `yaml:"apiVersion"`
+			Kind       string `yaml:"kind"`
+			Metadata   struct {
+				Name string `yaml:"name"`
+			} `yaml:"metadata"`
+		}
+		if err := yaml.Unmarshal([]byte(doc), &parsed); err != nil {
+			errs = append(errs, fmt.Errorf("%s (doc %d): invalid YAML: %w", path, i, err))
+			continue
+		}
+		if parsed.APIVersion == "" {
+			errs = append(errs, fmt.Errorf("%s (doc %d): missing apiVersion", path, i))
+		}
+		if parsed.Kind == "" {
+			errs = append(errs, fmt.Errorf("%s (doc %d): missing kind", path, i))
+		}
+		if parsed.Metadata.Name == "" {
+			errs = append(errs, fmt.Errorf("%s (doc %d): missing metadata.name", path, i))
+		}
+
+		if err := validateAgainstBundledSchema(parsed.Kind, doc); err != nil {
+			errs = append(errs, fmt.Errorf("%s (doc %d): %w", path, i, err))
+		}
+		if err := validateWithKubectl(doc); err != nil {
+			errs = append(errs, fmt.Errorf("%s (doc %d): %w", path, i, err))
+		}
+	}
+
+	return errs
+}
+
+// validateAgainstBundledSchema checks a manifest's spec: keys against a
+// bundled CRD OpenAPI schema at scripts/schemas/<Kind>.yaml, if one exists.
+// Schemas are optional and checked in separately; a missing schema is not an
+// error. The schema format expected is a trimmed-down OpenAPI v3 CRD schema:
+// `properties.spec.properties.<key>`.
+func validateAgainstBundledSchema(kind, doc string) error {
+	if kind == "" {
+		return nil
+	}
+
+	schemaPath := filepath.Join("scripts", "schemas", kind+".yaml")
+	schemaData, err := os.ReadFile(schemaPath)
+	if err != nil {
+		return nil
+	}
+
+	var schema struct {
+		Properties struct {
+			Spec struct {
+				Properties map[string]interface{} `yaml:"properties"`
+			} `yaml:"spec"`
+		} `yaml:"properties"`
+	}
+	if err := yaml.Unmarshal(schemaData, &schema); err != nil {
+		return nil
+	}
+	if len(schema.Properties.Spec.Properties) == 0 {
+		return nil
+	}
+
+	var manifest struct {
+		Spec map[string]interface{} `yaml:"spec"`
+	}
+	if err := yaml.Unmarshal([]byte(doc), &manifest); err != nil {
+		return nil
+	}
+
+	for key := range manifest.Spec {
+		if _, ok := schema.Properties.Spec.Properties[key]; !ok {
+			return fmt.Errorf("spec.%s is not defined in scripts/schemas/%s.yaml", key, kind)
+		}
+	}
+	return nil
+}
+
+// validateWithKubectl shells out to `kubectl apply --dry-run=client` for a
+// real server-side-adjacent validation when a kubeconfig is configured.
+// Without KUBECONFIG set (e.g. in most CI runs) or without a kubectl binary
+// on PATH, this is a no-op so -validate stays usable offline.
+func validateWithKubectl(doc string) error {
+	if os.Getenv("KUBECONFIG") == "" {
+		return nil
+	}
+	kubectlPath, err := exec.LookPath("kubectl")
+	if err != nil {
+		return nil
+	}
+
+	cmd := exec.Command(kubectlPath, "apply", "--dry-run=client", "-f", "-")
+	cmd.Stdin = strings.NewReader(doc)
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("kubectl --dry-run=client rejected manifest: %s", strings.TrimSpace(stderr.String()))
+	}
+	return nil
 }
 
 func main() {
+	applicationSetOnly := flag.Bool("applicationset-only", false, "only generate apps/applicationsets/, skip the apps/clusters/ directory tree")
+	dirsOnly := flag.Bool("dirs-only", false, "only generate the apps/clusters/ directory tree, skip apps/applicationsets/")
+	dryRun := flag.Bool("dry-run", false, "compute changes without writing to disk, printing a diff; exit 1 if the tree would change")
+	diffOnly := flag.Bool("diff", false, "alias for -dry-run")
+	validate := flag.Bool("validate", false, "validate every generated manifest; with -dry-run, aggregate all errors before exiting, otherwise stop at the first")
+	flag.Parse()
+	planMode := *dryRun || *diffOnly
+
+	if *applicationSetOnly && *dirsOnly {
+		fmt.Fprintln(os.Stderr, "Error: -applicationset-only and -dirs-only are mutually exclusive")
+		os.Exit(1)
+	}
+
+	var fs fsOp = applyFsOp{}
+	plan := &planFsOp{}
+	if planMode {
+		fs = plan
+	}
+	// apps/clusters/.../app-config.yaml isn't a Kubernetes manifest - it's
+	// the plain values file ApplicationSet's git generator reads - so only
+	// the ApplicationSet and Kargo resource writers go through -validate.
+	manifestFs := fs
+	var validationErrs []error
+	if *validate {
+		manifestFs = &validatingFsOp{fsOp: fs, aggregate: planMode, errs: &validationErrs}
+	}
+
 	// Find the repo root (where apps/ directory exists)
 	repoRoot, err := findRepoRoot()
 	if err != nil {
@@ -86,43 +465,114 @@ func main() {
 
 	fmt.Printf("Discovered %d apps\n", len(apps))
 
-	// Generate cluster directories
-	fmt.Println("\n=== Generating cluster directories ===")
 	clustersDir := filepath.Join(repoRoot, "apps", "clusters")
-	expectedStructure := buildExpectedStructure(apps)
-	if err := generateClusterDirs(clustersDir, apps); err != nil {
-		fmt.Fprintf(os.Stderr, "Error generating cluster directories: %v\n", err)
-		os.Exit(1)
+
+	if !*applicationSetOnly {
+		// Generate cluster directories
+		fmt.Println("\n=== Generating cluster directories ===")
+		expectedStructure := buildExpectedStructure(apps)
+		if err := generateClusterDirs(fs, clustersDir, apps); err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating cluster directories: %v\n", err)
+			os.Exit(1)
+		}
+
+		// Clean up stale directories
+		if err := cleanupStaleDirs(fs, clustersDir, expectedStructure); err != nil {
+			fmt.Fprintf(os.Stderr, "Error cleaning up stale directories: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
-	// Clean up stale directories
-	if err := cleanupStaleDirs(clustersDir, expectedStructure); err != nil {
-		fmt.Fprintf(os.Stderr, "Error cleaning up stale directories: %v\n", err)
-		os.Exit(1)
+	if !*dirsOnly {
+		// Generate ApplicationSet CRs
+		fmt.Println("\n=== Generating ApplicationSets ===")
+		applicationSetsDir := filepath.Join(repoRoot, "apps", "applicationsets")
+		mode := "perApp"
+		if config := readCredentialsConfig(repoRoot); config != nil && config.ApplicationSet.Mode != "" {
+			mode = config.ApplicationSet.Mode
+		}
+		if err := generateApplicationSets(manifestFs, applicationSetsDir, apps, mode, gitRepoURL); err != nil {
+			fmt.Fprintf(os.Stderr, "Error generating ApplicationSets: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	// Generate Kargo configs
 	fmt.Println("\n=== Generating Kargo configs ===")
 	kargoConfigsDir := filepath.Join(repoRoot, "apps", "kargo-configs")
 
-	// Clean up existing configs
-	if err := os.RemoveAll(kargoConfigsDir); err != nil {
-		fmt.Fprintf(os.Stderr, "Error cleaning up kargo-configs: %v\n", err)
-		os.Exit(1)
+	if planMode {
+		// Don't wipe the directory up front - diff file-by-file instead, and
+		// separately flag app directories that no longer have a matching app.
+		if err := removeStaleKargoConfigs(manifestFs, kargoConfigsDir, apps); err != nil {
+			fmt.Fprintf(os.Stderr, "Error checking for stale kargo-configs: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		// Clean up existing configs
+		if err := manifestFs.RemoveAll(kargoConfigsDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error cleaning up kargo-configs: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	// Generate Kargo resources for each app
 	for _, app := range apps {
 		fmt.Printf("\nGenerating Kargo configs for %s/%s...\n", app.Type, app.Name)
-		if err := generateKargoConfigs(kargoConfigsDir, app, gitRepoURL); err != nil {
+		if err := generateKargoConfigs(manifestFs, kargoConfigsDir, app, gitRepoURL); err != nil {
 			fmt.Fprintf(os.Stderr, "Error generating Kargo configs for %s: %v\n", app.Name, err)
 			os.Exit(1)
 		}
 	}
 
+	if *validate && len(validationErrs) > 0 {
+		fmt.Fprintf(os.Stderr, "\n%d manifest(s) failed validation:\n", len(validationErrs))
+		for _, verr := range validationErrs {
+			fmt.Fprintf(os.Stderr, "  - %v\n", verr)
+		}
+		os.Exit(1)
+	}
+
+	if planMode {
+		if plan.changed {
+			fmt.Println("\nTree is out of date.")
+			os.Exit(1)
+		}
+		fmt.Println("\nTree is up to date.")
+		return
+	}
+
 	fmt.Println("\nDone!")
 }
 
+// removeStaleKargoConfigs removes app directories under kargoConfigsDir that
+// no longer correspond to a discovered app, without touching directories
+// that are about to be regenerated.
+func removeStaleKargoConfigs(fs fsOp, kargoConfigsDir string, apps []AppInfo) error {
+	entries, err := os.ReadDir(kargoConfigsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	valid := make(map[string]bool, len(apps))
+	for _, app := range apps {
+		valid[app.Name] = true
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || valid[entry.Name()] {
+			continue
+		}
+		if err := fs.RemoveAll(filepath.Join(kargoConfigsDir, entry.Name())); err != nil {
+			return fmt.Errorf("removing stale %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
 // findRepoRoot finds the repository root by looking for the apps/ directory
 func findRepoRoot() (string, error) {
 	dir, err := os.Getwd()
@@ -151,18 +601,30 @@ func getGitRepoURL(repoRoot string) (string, error) {
 		return url, nil
 	}
 
-	// Try values-credentials.yaml
-	credentialsPath := filepath.Join(repoRoot, "values-credentials.yaml")
-	if data, err := os.ReadFile(credentialsPath); err == nil {
-		var config CredentialsConfig
-		if err := yaml.Unmarshal(data, &config); err == nil && config.GitRepo.URL != "" {
-			return config.GitRepo.URL, nil
-		}
+	if config := readCredentialsConfig(repoRoot); config != nil && config.GitRepo.URL != "" {
+		return config.GitRepo.URL, nil
 	}
 
 	return "", fmt.Errorf("GIT_REPO_URL not set and values-credentials.yaml not found or invalid")
 }
 
+// readCredentialsConfig reads values-credentials.yaml, returning nil if it
+// does not exist or cannot be parsed.
+func readCredentialsConfig(repoRoot string) *CredentialsConfig {
+	credentialsPath := filepath.Join(repoRoot, "values-credentials.yaml")
+	data, err := os.ReadFile(credentialsPath)
+	if err != nil {
+		return nil
+	}
+
+	var config CredentialsConfig
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return nil
+	}
+
+	return &config
+}
+
 // discoverApps finds all apps in apps/workloads/ and apps/infra/
 func discoverApps(repoRoot string) ([]AppInfo, error) {
 	var apps []AppInfo
@@ -181,9 +643,72 @@ func discoverApps(repoRoot string) ([]AppInfo, error) {
 	}
 	apps = append(apps, infraApps...)
 
+	if err := validateNamespaceOwnership(apps); err != nil {
+		return nil, err
+	}
+
 	return apps, nil
 }
 
+// validateNamespaceOwnership fails if two apps declare the same deploy
+// namespace but belong to different Kargo projects, since Kargo project
+// namespaces own the resources deployed into them.
+func validateNamespaceOwnership(apps []AppInfo) error {
+	projectByNamespace := make(map[string]string)
+	for _, app := range apps {
+		if owner, ok := projectByNamespace[app.Namespace]; ok && owner != app.ProjectNamespace {
+			return fmt.Errorf("namespace %q is claimed by project %q and project %q; apps sharing a deploy namespace must share a project", app.Namespace, owner, app.ProjectNamespace)
+		}
+		projectByNamespace[app.Namespace] = app.ProjectNamespace
+	}
+	return nil
+}
+
+// semverConstraintPattern matches the comparator/range syntax accepted by
+// Kargo's semver constraints (e.g. "^1.2.3", ">=1.0.0 <2.0.0", "~1.4 || 2.x").
+var semverConstraintPattern = regexp.MustCompile(`^[\w.\-+~^*<>=|, ]+$`)
+
+// validateWarehouseSubscriptions checks an app's explicit warehouse: block,
+// if any. An absent block (nil) is valid and falls back to the default
+// single-git subscription.
+func validateWarehouseSubscriptions(subs []WarehouseSubscription) error {
+	if subs == nil {
+		return nil
+	}
+	if len(subs) == 0 {
+		return fmt.Errorf("warehouse: block must declare at least one subscription")
+	}
+
+	for i, sub := range subs {
+		kinds := 0
+		if sub.Git != nil {
+			kinds++
+		}
+		if sub.Chart != nil {
+			kinds++
+		}
+		if sub.Image != nil {
+			kinds++
+		}
+		if kinds != 1 {
+			return fmt.Errorf("warehouse subscription %d must set exactly one of git, chart, or image (got %d)", i, kinds)
+		}
+
+		var constraint string
+		switch {
+		case sub.Chart != nil:
+			constraint = sub.Chart.SemverConstraint
+		case sub.Image != nil:
+			constraint = sub.Image.SemverConstraint
+		}
+		if constraint != "" && !semverConstraintPattern.MatchString(constraint) {
+			return fmt.Errorf("warehouse subscription %d: invalid semverConstraint %q", i, constraint)
+		}
+	}
+
+	return nil
+}
+
 // discoverAppsInDir discovers apps in a specific type directory (workloads or infra)
 func discoverAppsInDir(repoRoot, appType string) ([]AppInfo, error) {
 	var apps []AppInfo
@@ -220,11 +745,33 @@ func discoverAppsInDir(repoRoot, appType string) ([]AppInfo, error) {
 			return nil, fmt.Errorf("reading %s: %w", configPath, err)
 		}
 
+		namespace := config.Namespace
+		if namespace == "" {
+			namespace = appName
+		}
+		projectNamespace := config.ProjectNamespace
+		if projectNamespace == "" {
+			projectNamespace = namespace
+		}
+		allowClusterScopedResources := true
+		if config.AllowClusterScopedResources != nil {
+			allowClusterScopedResources = *config.AllowClusterScopedResources
+		}
+
+		if err := validateWarehouseSubscriptions(config.Warehouse); err != nil {
+			return nil, fmt.Errorf("%s: %w", configPath, err)
+		}
+
 		apps = append(apps, AppInfo{
-			Name:           appName,
-			Type:           appType,
-			SourcePath:     filepath.Join("apps", appType, appName),
-			TargetClusters: config.TargetClusters,
+			Name:                        appName,
+			Type:                        appType,
+			SourcePath:                  filepath.Join("apps", appType, appName),
+			TargetClusters:              config.TargetClusters,
+			PromotionGraph:              config.PromotionGraph,
+			Namespace:                   namespace,
+			ProjectNamespace:            projectNamespace,
+			AllowClusterScopedResources: allowClusterScopedResources,
+			Warehouse:                   config.Warehouse,
 		})
 
 		fmt.Printf("  Found %s/%s targeting %v\n", appType, appName, config.TargetClusters)
@@ -268,20 +815,22 @@ func buildExpectedStructure(apps []AppInfo) map[string]map[string]map[string]boo
 }
 
 // generateClusterDirs creates the cluster-specific directories and app-config.yaml files
-func generateClusterDirs(clustersDir string, apps []AppInfo) error {
+func generateClusterDirs(fs fsOp, clustersDir string, apps []AppInfo) error {
 	for _, app := range apps {
 		for _, cluster := range app.TargetClusters {
 			appDir := filepath.Join(clustersDir, cluster, app.Type, app.Name)
 
 			// Create directory
-			if err := os.MkdirAll(appDir, 0755); err != nil {
+			if err := fs.MkdirAll(appDir, 0755); err != nil {
 				return fmt.Errorf("creating %s: %w", appDir, err)
 			}
 
 			// Generate app-config.yaml
 			configPath := filepath.Join(appDir, "app-config.yaml")
 			config := GeneratedConfig{
-				ChartPath: app.SourcePath,
+				ChartPath:        app.SourcePath,
+				Namespace:        app.Namespace,
+				ProjectNamespace: app.ProjectNamespace,
 			}
 
 			data, err := yaml.Marshal(&config)
@@ -292,7 +841,7 @@ func generateClusterDirs(clustersDir string, apps []AppInfo) error {
 			// Add header comment
 			content := fmt.Sprintf("# GENERATED - DO NOT EDIT\n# Source: %s/app-config.yaml\n# Run 'go run scripts/generate-configs.go' to regenerate\n%s", app.SourcePath, string(data))
 
-			if err := os.WriteFile(configPath, []byte(content), 0644); err != nil {
+			if err := fs.WriteFile(configPath, []byte(content), 0644); err != nil {
 				return fmt.Errorf("writing %s: %w", configPath, err)
 			}
 
@@ -304,7 +853,7 @@ func generateClusterDirs(clustersDir string, apps []AppInfo) error {
 }
 
 // cleanupStaleDirs removes directories that should no longer exist
-func cleanupStaleDirs(clustersDir string, expected map[string]map[string]map[string]bool) error {
+func cleanupStaleDirs(fs fsOp, clustersDir string, expected map[string]map[string]map[string]bool) error {
 	// Check if clusters directory exists
 	if _, err := os.Stat(clustersDir); os.IsNotExist(err) {
 		return nil
@@ -349,24 +898,33 @@ func cleanupStaleDirs(clustersDir string, expected map[string]map[string]map[str
 				if !shouldExist {
 					appDir := filepath.Join(typeDir, appName)
 					fmt.Printf("  Removing stale directory: %s\n", appDir)
-					if err := os.RemoveAll(appDir); err != nil {
+					if err := fs.RemoveAll(appDir); err != nil {
 						return fmt.Errorf("removing %s: %w", appDir, err)
 					}
 				}
 			}
 
-			// Remove empty type directory
-			remaining, _ := os.ReadDir(typeDir)
-			if len(remaining) == 0 {
-				os.Remove(typeDir)
+			// Remove the type directory once it no longer has any expected
+			// app under it. Derived from expected rather than re-reading the
+			// directory, since in -dry-run mode fs.RemoveAll above didn't
+			// actually delete the stale app dirs we just "would remove".
+			if len(expected[cluster][appType]) == 0 {
+				fs.Remove(typeDir)
 			}
 		}
 
-		// Remove empty cluster directory
-		clusterDir := filepath.Join(clustersDir, cluster)
-		remaining, _ := os.ReadDir(clusterDir)
-		if len(remaining) == 0 {
-			os.Remove(clusterDir)
+		// Remove the cluster directory once no type under it has any
+		// expected app left, for the same reason as above.
+		clusterEmpty := true
+		for _, appType := range []string{"workloads", "infra"} {
+			if len(expected[cluster][appType]) > 0 {
+				clusterEmpty = false
+				break
+			}
+		}
+		if clusterEmpty {
+			clusterDir := filepath.Join(clustersDir, cluster)
+			fs.Remove(clusterDir)
 		}
 	}
 
@@ -400,64 +958,303 @@ func cleanupStaleDirs(clustersDir string, expected map[string]map[string]map[str
 	return nil
 }
 
+// generateApplicationSets writes ArgoCD ApplicationSet CRs under
+// apps/applicationsets/ that discover the generated apps/clusters/ directory
+// tree, so ArgoCD can be pointed at real ApplicationSet resources instead of
+// relying on a directory convention alone.
+//
+// Each ApplicationSet combines a git-files generator (reading the generated
+// app-config.yaml files for their chartPath) with a cluster generator
+// (filtered to the cluster named in the file's path) via a matrix generator,
+// so an Application is only rendered for clusters the app actually targets.
+//
+// mode controls grouping: "perApp" (the default) emits one ApplicationSet
+// per (type, app) pair; "perCluster" emits one ApplicationSet per target
+// cluster, covering every app deployed there.
+func generateApplicationSets(fs fsOp, applicationSetsDir string, apps []AppInfo, mode, gitRepoURL string) error {
+	if err := fs.MkdirAll(applicationSetsDir, 0755); err != nil {
+		return fmt.Errorf("creating %s: %w", applicationSetsDir, err)
+	}
+
+	var expected map[string]bool
+	var err error
+	switch mode {
+	case "", "perApp":
+		expected = expectedApplicationSetFilenames(apps, func(app AppInfo) string {
+			return fmt.Sprintf("%s-%s.yaml", app.Type, app.Name)
+		})
+		err = generateApplicationSetsPerApp(fs, applicationSetsDir, apps, gitRepoURL)
+	case "perCluster":
+		expected = expectedApplicationSetFilenames(apps, nil)
+		err = generateApplicationSetsPerCluster(fs, applicationSetsDir, apps, gitRepoURL)
+	default:
+		return fmt.Errorf("unknown applicationSet.mode %q (expected \"perApp\" or \"perCluster\")", mode)
+	}
+	if err != nil {
+		return err
+	}
+
+	return removeStaleApplicationSets(fs, applicationSetsDir, expected)
+}
+
+// expectedApplicationSetFilenames computes the set of ApplicationSet
+// filenames that should exist for the given mode. perAppFilename is nil in
+// perCluster mode, where filenames are keyed by target cluster instead.
+func expectedApplicationSetFilenames(apps []AppInfo, perAppFilename func(AppInfo) string) map[string]bool {
+	expected := make(map[string]bool)
+	if perAppFilename != nil {
+		for _, app := range apps {
+			if len(app.TargetClusters) > 0 {
+				expected[perAppFilename(app)] = true
+			}
+		}
+		return expected
+	}
+
+	for _, app := range apps {
+		for _, cluster := range app.TargetClusters {
+			expected[cluster+".yaml"] = true
+		}
+	}
+	return expected
+}
+
+// removeStaleApplicationSets removes generated ApplicationSet files that no
+// longer correspond to an expected filename, without wiping the directory
+// (which would defeat per-file diffing in dry-run mode).
+func removeStaleApplicationSets(fs fsOp, applicationSetsDir string, expected map[string]bool) error {
+	entries, err := os.ReadDir(applicationSetsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() && expected[entry.Name()] {
+			continue
+		}
+		path := filepath.Join(applicationSetsDir, entry.Name())
+		if entry.IsDir() {
+			if err := fs.RemoveAll(path); err != nil {
+				return fmt.Errorf("removing stale %s: %w", entry.Name(), err)
+			}
+			continue
+		}
+		if err := fs.Remove(path); err != nil {
+			return fmt.Errorf("removing stale %s: %w", entry.Name(), err)
+		}
+	}
+	return nil
+}
+
+// generateApplicationSetsPerApp emits one ApplicationSet per (type, app) pair.
+func generateApplicationSetsPerApp(fs fsOp, applicationSetsDir string, apps []AppInfo, gitRepoURL string) error {
+	for _, app := range apps {
+		if len(app.TargetClusters) == 0 {
+			continue
+		}
+
+		name := fmt.Sprintf("%s-%s", app.Type, app.Name)
+		filesPath := fmt.Sprintf("apps/clusters/*/%s/%s/app-config.yaml", app.Type, app.Name)
+
+		content := fmt.Sprintf(`# GENERATED - DO NOT EDIT
+# Source: %s/app-config.yaml
+# Run 'go run scripts/generate-configs.go' to regenerate
+apiVersion: argoproj.io/v1alpha1
+kind: ApplicationSet
+metadata:
+  name: %s
+  namespace: argocd
+spec:
+  generators:
+    - matrix:
+        generators:
+          - git:
+              repoURL: %s
+              revision: HEAD
+              files:
+                - path: %s
+          - clusters:
+              selector:
+                matchLabels:
+                  cluster-name: '{{path[2]}}'
+  template:
+    metadata:
+      name: '{{path[2]}}-%s'
+    spec:
+      project: %s
+      source:
+        repoURL: %s
+        targetRevision: HEAD
+        path: '{{chartPath}}'
+      destination:
+        server: '{{server}}'
+        namespace: %s
+`, app.SourcePath, name, gitRepoURL, filesPath, name, app.ProjectNamespace, gitRepoURL, app.Namespace)
+
+		path := filepath.Join(applicationSetsDir, name+".yaml")
+		if err := fs.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", path, err)
+		}
+		fmt.Printf("  Generated %s\n", path)
+	}
+
+	return nil
+}
+
+// generateApplicationSetsPerCluster emits one ApplicationSet per target
+// cluster, discovering every app deployed there.
+func generateApplicationSetsPerCluster(fs fsOp, applicationSetsDir string, apps []AppInfo, gitRepoURL string) error {
+	clusterSet := make(map[string]bool)
+	for _, app := range apps {
+		for _, cluster := range app.TargetClusters {
+			clusterSet[cluster] = true
+		}
+	}
+
+	var clusters []string
+	for cluster := range clusterSet {
+		clusters = append(clusters, cluster)
+	}
+	sort.Strings(clusters)
+
+	for _, cluster := range clusters {
+		filesPath := fmt.Sprintf("apps/clusters/%s/*/*/app-config.yaml", cluster)
+
+		content := fmt.Sprintf(`# GENERATED - DO NOT EDIT
+# Run 'go run scripts/generate-configs.go' to regenerate
+apiVersion: argoproj.io/v1alpha1
+kind: ApplicationSet
+metadata:
+  name: %s
+  namespace: argocd
+spec:
+  generators:
+    - matrix:
+        generators:
+          - git:
+              repoURL: %s
+              revision: HEAD
+              files:
+                - path: %s
+          - clusters:
+              selector:
+                matchLabels:
+                  cluster-name: %s
+  template:
+    metadata:
+      name: '%s-{{path[3]}}-{{path[4]}}'
+    spec:
+      project: '{{projectNamespace}}'
+      source:
+        repoURL: %s
+        targetRevision: HEAD
+        path: '{{chartPath}}'
+      destination:
+        server: '{{server}}'
+        namespace: '{{namespace}}'
+`, cluster, gitRepoURL, filesPath, cluster, cluster, gitRepoURL)
+
+		path := filepath.Join(applicationSetsDir, cluster+".yaml")
+		if err := fs.WriteFile(path, []byte(content), 0644); err != nil {
+			return fmt.Errorf("writing %s: %w", path, err)
+		}
+		fmt.Printf("  Generated %s\n", path)
+	}
+
+	return nil
+}
+
 // generateKargoConfigs generates all Kargo resources for an app
-func generateKargoConfigs(kargoConfigsDir string, app AppInfo, gitRepoURL string) error {
+func generateKargoConfigs(fs fsOp, kargoConfigsDir string, app AppInfo, gitRepoURL string) error {
 	appDir := filepath.Join(kargoConfigsDir, app.Name)
-	if err := os.MkdirAll(appDir, 0755); err != nil {
+	if err := fs.MkdirAll(appDir, 0755); err != nil {
 		return fmt.Errorf("creating directory: %w", err)
 	}
 
 	// Build stage order for this app
-	stages := buildStageOrder(app.TargetClusters)
+	stages, err := buildStageOrder(app)
+	if err != nil {
+		return fmt.Errorf("building stage order: %w", err)
+	}
 
 	// Generate Namespace with Kargo label (allows Kargo to adopt existing namespaces)
-	if err := generateNamespace(appDir, app); err != nil {
+	if err := generateNamespace(fs, appDir, app); err != nil {
 		return fmt.Errorf("generating namespace: %w", err)
 	}
 
 	// Generate Project
-	if err := generateProject(appDir, app); err != nil {
+	if err := generateProject(fs, appDir, app); err != nil {
 		return fmt.Errorf("generating project: %w", err)
 	}
 
 	// Generate ProjectConfig with promotion policies
-	if err := generateProjectConfig(appDir, app, stages); err != nil {
+	if err := generateProjectConfig(fs, appDir, app, stages); err != nil {
 		return fmt.Errorf("generating project config: %w", err)
 	}
 
 	// Generate Warehouse
-	if err := generateWarehouse(appDir, app, gitRepoURL); err != nil {
+	if err := generateWarehouse(fs, appDir, app, gitRepoURL); err != nil {
 		return fmt.Errorf("generating warehouse: %w", err)
 	}
 
 	// Generate Stages
-	if err := generateStagesFromList(appDir, app, stages, gitRepoURL); err != nil {
+	if err := generateStagesFromList(fs, appDir, app, stages, gitRepoURL); err != nil {
 		return fmt.Errorf("generating stages: %w", err)
 	}
 
 	return nil
 }
 
-// generateNamespace generates a Namespace resource with Kargo project label
-// This allows Kargo to adopt existing namespaces that were created by other apps
-func generateNamespace(appDir string, app AppInfo) error {
-	content := fmt.Sprintf(`# GENERATED - DO NOT EDIT
-# Source: %s/app-config.yaml
-# Run 'go run scripts/generate-configs.go' to regenerate
-#
+// generateNamespace generates the Namespace resource(s) for an app. When the
+// deploy namespace and the Kargo project namespace are the same (the common
+// case), a single namespace carries the Kargo adoption label. When they
+// differ, the deploy namespace is left unlabeled and a separate project
+// namespace resource is emitted instead.
+func generateNamespace(fs fsOp, appDir string, app AppInfo) error {
+	if app.Namespace == app.ProjectNamespace {
+		return generateNamespaceResource(fs, appDir, "namespace.yaml", app, app.Namespace, true)
+	}
+
+	if err := generateNamespaceResource(fs, appDir, "namespace.yaml", app, app.Namespace, false); err != nil {
+		return err
+	}
+	return generateNamespaceResource(fs, appDir, "project-namespace.yaml", app, app.ProjectNamespace, true)
+}
+
+// generateNamespaceResource writes a single Namespace resource, optionally
+// labeled for Kargo project adoption.
+func generateNamespaceResource(fs fsOp, appDir, filename string, app AppInfo, name string, isProjectNamespace bool) error {
+	var comment, labels string
+	if isProjectNamespace {
+		comment = `#
 # This namespace resource labels the namespace for Kargo project adoption.
 # If the namespace already exists (e.g., created by the app deployment),
 # this will add the required label so Kargo can manage it as a Project.
-apiVersion: v1
+`
+		labels = `  labels:
+    kargo.akuity.io/project: "true"
+`
+	} else {
+		comment = `#
+# This is the app's deploy namespace. It is separate from the Kargo project
+# namespace (see project-namespace.yaml), so it is not labeled for adoption.
+`
+	}
+
+	content := fmt.Sprintf(`# GENERATED - DO NOT EDIT
+# Source: %s/app-config.yaml
+# Run 'go run scripts/generate-configs.go' to regenerate
+%sapiVersion: v1
 kind: Namespace
 metadata:
   name: %s
-  labels:
-    kargo.akuity.io/project: "true"
-`, app.SourcePath, app.Name)
+%s`, app.SourcePath, comment, name, labels)
 
-	path := filepath.Join(appDir, "namespace.yaml")
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	path := filepath.Join(appDir, filename)
+	if err := fs.WriteFile(path, []byte(content), 0644); err != nil {
 		return err
 	}
 	fmt.Printf("  Generated %s\n", path)
@@ -465,7 +1262,7 @@ metadata:
 }
 
 // generateProject generates the Kargo Project resource
-func generateProject(appDir string, app AppInfo) error {
+func generateProject(fs fsOp, appDir string, app AppInfo) error {
 	content := fmt.Sprintf(`# GENERATED - DO NOT EDIT
 # Source: %s/app-config.yaml
 # Run 'go run scripts/generate-configs.go' to regenerate
@@ -473,10 +1270,10 @@ apiVersion: kargo.akuity.io/v1alpha1
 kind: Project
 metadata:
   name: %s
-`, app.SourcePath, app.Name)
+`, app.SourcePath, app.ProjectNamespace)
 
 	path := filepath.Join(appDir, "project.yaml")
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	if err := fs.WriteFile(path, []byte(content), 0644); err != nil {
 		return err
 	}
 	fmt.Printf("  Generated %s\n", path)
@@ -485,7 +1282,7 @@ metadata:
 
 // generateProjectConfig generates the Kargo ProjectConfig resource
 // This enables auto-promotion for all stages except test
-func generateProjectConfig(appDir string, app AppInfo, stages []StageInfo) error {
+func generateProjectConfig(fs fsOp, appDir string, app AppInfo, stages []StageInfo) error {
 	// Build promotion policies - enable auto-promotion for all stages except test
 	var policies strings.Builder
 	for _, stage := range stages {
@@ -497,6 +1294,16 @@ func generateProjectConfig(appDir string, app AppInfo, stages []StageInfo) error
 		}
 	}
 
+	// A namespaced app isn't allowed to promote cluster-scoped manifests,
+	// mirroring the "namespaced owner can't own cluster-scoped resources"
+	// safety model. The controller keys off this annotation.
+	var restriction string
+	if !app.AllowClusterScopedResources {
+		restriction = `  annotations:
+    kargo.akuity.io/allow-cluster-scoped-resources: "false"
+`
+	}
+
 	content := fmt.Sprintf(`# GENERATED - DO NOT EDIT
 # Source: %s/app-config.yaml
 # Run 'go run scripts/generate-configs.go' to regenerate
@@ -508,20 +1315,43 @@ kind: ProjectConfig
 metadata:
   name: %s
   namespace: %s
-spec:
+%sspec:
   promotionPolicies:
-%s`, app.SourcePath, app.Name, app.Name, policies.String())
+%s`, app.SourcePath, app.ProjectNamespace, app.ProjectNamespace, restriction, policies.String())
 
 	path := filepath.Join(appDir, "project-config.yaml")
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	if err := fs.WriteFile(path, []byte(content), 0644); err != nil {
 		return err
 	}
 	fmt.Printf("  Generated %s\n", path)
 	return nil
 }
 
-// generateWarehouse generates the Kargo Warehouse resource
-func generateWarehouse(appDir string, app AppInfo, gitRepoURL string) error {
+// generateWarehouse generates the Kargo Warehouse resource. When the app
+// declares no warehouse: block, it falls back to the original single git
+// subscription on SourcePath for compatibility.
+func generateWarehouse(fs fsOp, appDir string, app AppInfo, gitRepoURL string) error {
+	var subscriptions strings.Builder
+	if len(app.Warehouse) == 0 {
+		subscriptions.WriteString(fmt.Sprintf(`    - git:
+        repoURL: %s
+        branch: main
+        includePaths:
+          - %s
+`, gitRepoURL, app.SourcePath))
+	} else {
+		for _, sub := range app.Warehouse {
+			switch {
+			case sub.Git != nil:
+				subscriptions.WriteString(generateGitSubscriptionYAML(sub.Git))
+			case sub.Chart != nil:
+				subscriptions.WriteString(generateChartSubscriptionYAML(sub.Chart))
+			case sub.Image != nil:
+				subscriptions.WriteString(generateImageSubscriptionYAML(sub.Image))
+			}
+		}
+	}
+
 	content := fmt.Sprintf(`# GENERATED - DO NOT EDIT
 # Source: %s/app-config.yaml
 # Run 'go run scripts/generate-configs.go' to regenerate
@@ -532,23 +1362,69 @@ metadata:
   namespace: %s
 spec:
   subscriptions:
-    - git:
-        repoURL: %s
-        branch: main
-        includePaths:
-          - %s
-`, app.SourcePath, app.Name, app.Name, gitRepoURL, app.SourcePath)
+%s`, app.SourcePath, app.Name, app.ProjectNamespace, subscriptions.String())
 
 	path := filepath.Join(appDir, "warehouse.yaml")
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	if err := fs.WriteFile(path, []byte(content), 0644); err != nil {
 		return err
 	}
 	fmt.Printf("  Generated %s\n", path)
 	return nil
 }
 
+// generateGitSubscriptionYAML emits a single git subscription entry.
+func generateGitSubscriptionYAML(git *GitSubscription) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("    - git:\n        repoURL: %s\n", git.RepoURL))
+	if git.Branch != "" {
+		b.WriteString(fmt.Sprintf("        branch: %s\n", git.Branch))
+	}
+	if len(git.IncludePaths) > 0 {
+		b.WriteString("        includePaths:\n")
+		for _, p := range git.IncludePaths {
+			b.WriteString(fmt.Sprintf("          - %s\n", p))
+		}
+	}
+	if len(git.ExcludePaths) > 0 {
+		b.WriteString("        excludePaths:\n")
+		for _, p := range git.ExcludePaths {
+			b.WriteString(fmt.Sprintf("          - %s\n", p))
+		}
+	}
+	return b.String()
+}
+
+// generateChartSubscriptionYAML emits a single Helm chart subscription entry.
+func generateChartSubscriptionYAML(chart *ChartSubscription) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("    - chart:\n        repoURL: %s\n", chart.RepoURL))
+	if chart.Name != "" {
+		b.WriteString(fmt.Sprintf("        name: %s\n", chart.Name))
+	}
+	if chart.SemverConstraint != "" {
+		b.WriteString(fmt.Sprintf("        semverConstraint: %s\n", chart.SemverConstraint))
+	}
+	return b.String()
+}
+
+// generateImageSubscriptionYAML emits a single container image subscription entry.
+func generateImageSubscriptionYAML(img *ImageSubscription) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("    - image:\n        repoURL: %s\n", img.RepoURL))
+	if img.SemverConstraint != "" {
+		b.WriteString(fmt.Sprintf("        semverConstraint: %s\n", img.SemverConstraint))
+	}
+	if img.TagRegex != "" {
+		b.WriteString(fmt.Sprintf("        tagRegex: %s\n", img.TagRegex))
+	}
+	if img.Platform != "" {
+		b.WriteString(fmt.Sprintf("        platform: %s\n", img.Platform))
+	}
+	return b.String()
+}
+
 // generateStages generates all Kargo Stage resources for an app
-func generateStagesFromList(appDir string, app AppInfo, stages []StageInfo, gitRepoURL string) error {
+func generateStagesFromList(fs fsOp, appDir string, app AppInfo, stages []StageInfo, gitRepoURL string) error {
 	var stagesContent strings.Builder
 	stagesContent.WriteString(fmt.Sprintf(`# GENERATED - DO NOT EDIT
 # Source: %s/app-config.yaml
@@ -566,15 +1442,112 @@ func generateStagesFromList(appDir string, app AppInfo, stages []StageInfo, gitR
 	}
 
 	path := filepath.Join(appDir, "stages.yaml")
-	if err := os.WriteFile(path, []byte(stagesContent.String()), 0644); err != nil {
+	if err := fs.WriteFile(path, []byte(stagesContent.String()), 0644); err != nil {
 		return err
 	}
 	fmt.Printf("  Generated %s\n", path)
 	return nil
 }
 
-// buildStageOrder returns the ordered list of stages for the app based on target clusters
-func buildStageOrder(targetClusters []string) []StageInfo {
+// buildStageOrder returns the ordered list of stages for the app. If the app
+// declares its own promotionGraph, it's resolved as a DAG (validated,
+// topologically sorted, ties broken alphabetically for diff-stable output).
+// Otherwise the legacy targetClusters list is lowered into the default
+// linear+parallel graph, preserving today's behavior.
+func buildStageOrder(app AppInfo) ([]StageInfo, error) {
+	if len(app.PromotionGraph) > 0 {
+		return resolvePromotionGraph(app.PromotionGraph)
+	}
+	return buildDefaultStageOrder(app.TargetClusters), nil
+}
+
+// resolvePromotionGraph validates and topologically sorts a declarative
+// promotionGraph, returning stages in deterministic order with their
+// resolved upstreams.
+func resolvePromotionGraph(nodes []PromotionGraphNode) ([]StageInfo, error) {
+	byName := make(map[string]PromotionGraphNode, len(nodes))
+	for _, n := range nodes {
+		if _, exists := byName[n.Name]; exists {
+			return nil, fmt.Errorf("duplicate promotionGraph stage name %q", n.Name)
+		}
+		byName[n.Name] = n
+	}
+
+	for _, n := range nodes {
+		for _, upstream := range n.Upstreams {
+			if _, ok := byName[upstream]; !ok {
+				return nil, fmt.Errorf("promotionGraph stage %q references unknown upstream %q", n.Name, upstream)
+			}
+		}
+	}
+
+	var order []string
+	visiting := make(map[string]bool)
+	visited := make(map[string]bool)
+
+	var names []string
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		if visited[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("promotionGraph has a cycle involving stage %q", name)
+		}
+		visiting[name] = true
+
+		upstreams := append([]string(nil), byName[name].Upstreams...)
+		sort.Strings(upstreams)
+		for _, upstream := range upstreams {
+			if err := visit(upstream); err != nil {
+				return err
+			}
+		}
+
+		visiting[name] = false
+		visited[name] = true
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+
+	stages := make([]StageInfo, 0, len(order))
+	for _, name := range order {
+		node := byName[name]
+		upstreams := append([]string(nil), node.Upstreams...)
+		sort.Strings(upstreams)
+		// Shard falls back to the stage's target cluster (so a stage named
+		// differently from the cluster it promotes to, e.g. a "canary" stage
+		// fanning in from prod-us, still routes to the right Kargo agent)
+		// before generateStageYAML's own fallback to the stage name.
+		shard := node.Shard
+		if shard == "" {
+			shard = node.Cluster
+		}
+		stages = append(stages, StageInfo{
+			Name:      node.Name,
+			Shard:     shard,
+			Upstreams: upstreams,
+		})
+	}
+	return stages, nil
+}
+
+// buildDefaultStageOrder returns the ordered list of stages for the app
+// based on target clusters, using the legacy two-tier pipeline shape: a
+// linear test -> dev -> staging chain, with prod/infra stages fanning out
+// in parallel from the last stage in that chain.
+func buildDefaultStageOrder(targetClusters []string) []StageInfo {
 	var stages []StageInfo
 	clusterSet := make(map[string]bool)
 	for _, c := range targetClusters {
@@ -597,8 +1570,9 @@ func buildStageOrder(targetClusters []string) []StageInfo {
 				}
 			}
 			stages = append(stages, StageInfo{
-				Name:     cluster,
-				Upstream: upstream,
+				Name:      cluster,
+				Shard:     cluster,
+				Upstreams: upstreamsOf(upstream),
 			})
 		}
 	}
@@ -622,20 +1596,35 @@ func buildStageOrder(targetClusters []string) []StageInfo {
 	sort.Strings(parallelToAdd)
 
 	for _, cluster := range parallelToAdd {
+		// infra uses the default shard (no shard specified), same as generateStageYAML's legacy behavior
+		shard := cluster
+		if cluster == "infra" {
+			shard = ""
+		}
 		stages = append(stages, StageInfo{
-			Name:     cluster,
-			Upstream: lastSequential,
+			Name:      cluster,
+			Shard:     shard,
+			Upstreams: upstreamsOf(lastSequential),
 		})
 	}
 
 	return stages
 }
 
+// upstreamsOf wraps a single upstream name into the []string form StageInfo
+// expects, or returns nil for "pull directly from warehouse".
+func upstreamsOf(upstream string) []string {
+	if upstream == "" {
+		return nil
+	}
+	return []string{upstream}
+}
+
 // generateStageYAML generates the YAML for a single stage
 func generateStageYAML(app AppInfo, stage StageInfo, gitRepoURL string) string {
 	var requestedFreight string
 
-	if stage.Upstream == "" {
+	if len(stage.Upstreams) == 0 {
 		// First stage - get directly from warehouse, no auto-promotion
 		requestedFreight = fmt.Sprintf(`  requestedFreight:
     - origin:
@@ -644,23 +1633,32 @@ func generateStageYAML(app AppInfo, stage StageInfo, gitRepoURL string) string {
       sources:
         direct: true`, app.Name)
 	} else {
-		// Downstream stage - get from upstream stage with MatchUpstream auto-promotion
+		// Downstream stage - get from one or more upstream stages (fan-in)
+		// with MatchUpstream auto-promotion
+		var upstreams strings.Builder
+		for _, u := range stage.Upstreams {
+			upstreams.WriteString(fmt.Sprintf("          - %s\n", u))
+		}
 		requestedFreight = fmt.Sprintf(`  requestedFreight:
     - origin:
         kind: Warehouse
         name: %s
       sources:
         stages:
-          - %s
-        autoPromotionOptions:
-          selectionPolicy: MatchUpstream`, app.Name, stage.Upstream)
+%s        autoPromotionOptions:
+          selectionPolicy: MatchUpstream`, app.Name, upstreams.String())
 	}
 
-	// Infra stage uses default shard (no shard specified)
+	// Infra stage uses default shard (no shard specified) unless its
+	// StageInfo carries one, which a promotionGraph node does whenever it
+	// sets shard or cluster.
 	var shardField string
-	if stage.Name == "infra" {
+	switch {
+	case stage.Shard != "":
+		shardField = fmt.Sprintf("  shard: %s\n", stage.Shard)
+	case stage.Name == "infra":
 		shardField = ""
-	} else {
+	default:
 		shardField = fmt.Sprintf("  shard: %s\n", stage.Name)
 	}
 
@@ -674,9 +1672,47 @@ spec:
   promotionTemplate:
     spec:
       steps:
-        - uses: argocd-update
+%s        - uses: argocd-update
           config:
             apps:
               - name: %s
-`, stage.Name, app.Name, shardField, requestedFreight, app.Name)
+                namespace: %s
+`, stage.Name, app.ProjectNamespace, shardField, requestedFreight, generatePreSyncSteps(app), app.Name, app.Namespace)
+}
+
+// generatePreSyncSteps emits a helm-update-chart step for each chart
+// subscription and a kustomize-set-image step for each image subscription,
+// so the freight's discovered versions are written in ahead of argocd-update.
+// Apps with no such subscriptions (the common case) get no extra steps.
+func generatePreSyncSteps(app AppInfo) string {
+	var steps strings.Builder
+
+	for _, sub := range app.Warehouse {
+		if sub.Chart == nil {
+			continue
+		}
+		steps.WriteString(fmt.Sprintf(`        - uses: helm-update-chart
+          config:
+            path: ./src/%s
+            charts:
+              - repoURL: %s
+                name: %s
+                newVersion: ${{ chartFrom("%s", "%s").Version }}
+`, app.SourcePath, sub.Chart.RepoURL, sub.Chart.Name, sub.Chart.RepoURL, sub.Chart.Name))
+	}
+
+	for _, sub := range app.Warehouse {
+		if sub.Image == nil {
+			continue
+		}
+		steps.WriteString(fmt.Sprintf(`        - uses: kustomize-set-image
+          config:
+            path: ./src/%s
+            images:
+              - image: %s
+                tag: ${{ imageFrom("%s").Tag }}
+`, app.SourcePath, sub.Image.RepoURL, sub.Image.RepoURL))
+	}
+
+	return steps.String()
 }
@@ -3,6 +3,7 @@
 // and generates Kargo resources (Project, Warehouse, Stages) under apps/kargo-configs/.
 //
 // Usage: go run scripts/generate-kargo-pipelines.go
+//        go run scripts/generate-kargo-pipelines.go -dry-run   # print a diff, exit 1 on drift
 //
 // The script is idempotent and safe to run multiple times.
 // It regenerates all Kargo manifests on each run.
@@ -13,6 +14,7 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -22,13 +24,108 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
-// Promotion order: test → dev → staging → (prod-us, prod-eu, prod-au, infra)
+// Default promotion order used when an app doesn't declare its own
+// pipeline: test → dev → staging → (prod-us, prod-eu, prod-au, infra)
 var promotionOrder = []string{"test", "dev", "staging"}
 var parallelStages = []string{"prod-us", "prod-eu", "prod-au", "infra"}
 
 // AppConfig represents the structure of app-config.yaml
 type AppConfig struct {
-	TargetClusters []string `yaml:"targetClusters"`
+	TargetClusters []string             `yaml:"targetClusters"`
+	Promotion      *PromotionConfig     `yaml:"promotion"`
+	Subscriptions  *SubscriptionsConfig `yaml:"subscriptions"`
+	Pipeline       []PipelineNode       `yaml:"pipeline"`
+	Verification   *VerificationConfig  `yaml:"verification"`
+}
+
+// VerificationConfig is the app-config.yaml `verification:` block. Its keys
+// are stage names (or "default", used when a stage has no entry of its own)
+// inlined directly into the map, alongside one reserved "templates" key for
+// AnalysisTemplates the user wants to embed rather than merely reference.
+type VerificationConfig struct {
+	Templates []InlineAnalysisTemplate     `yaml:"templates"`
+	Stages    map[string]StageVerification `yaml:",inline"`
+}
+
+// StageVerification is the verification config for a single stage.
+type StageVerification struct {
+	Templates           []AnalysisTemplateRef `yaml:"templates"`
+	AnalysisRunMetadata *AnalysisRunMetadata  `yaml:"analysisRunMetadata"`
+}
+
+// AnalysisTemplateRef references an existing AnalysisTemplate.
+type AnalysisTemplateRef struct {
+	Name      string        `yaml:"name"`
+	Namespace string        `yaml:"namespace"`
+	Args      []AnalysisArg `yaml:"args"`
+}
+
+// AnalysisArg is a single argument passed to an AnalysisTemplate.
+type AnalysisArg struct {
+	Name  string `yaml:"name"`
+	Value string `yaml:"value"`
+}
+
+// AnalysisRunMetadata carries labels/annotations onto the AnalysisRuns Kargo
+// creates for a stage's verification.
+type AnalysisRunMetadata struct {
+	Labels      map[string]string `yaml:"labels"`
+	Annotations map[string]string `yaml:"annotations"`
+}
+
+// InlineAnalysisTemplate is a full AnalysisTemplate the user embeds in
+// app-config.yaml instead of applying one to the cluster by hand. Spec is
+// passed through as-is since its shape (Prometheus/Datadog metrics, args,
+// etc.) is entirely up to the user.
+type InlineAnalysisTemplate struct {
+	Name string                 `yaml:"name"`
+	Spec map[string]interface{} `yaml:"spec"`
+}
+
+// PipelineNode describes one stage in an app's declarative promotion DAG.
+// An empty After means the stage pulls freight directly from the Warehouse;
+// multiple entries in After mean the stage fans in from several upstreams.
+type PipelineNode struct {
+	Name    string   `yaml:"name"`
+	Cluster string   `yaml:"cluster"`
+	Shard   string   `yaml:"shard"`
+	After   []string `yaml:"after"`
+}
+
+// SubscriptionsConfig declares additional Warehouse subscriptions beyond the
+// app's own git source - container images and/or Helm charts the app wants
+// to track as freight.
+type SubscriptionsConfig struct {
+	Images []ImageSubscription `yaml:"images"`
+	Charts []ChartSubscription `yaml:"charts"`
+}
+
+// ImageSubscription is a container image Warehouse subscription.
+type ImageSubscription struct {
+	RepoURL              string   `yaml:"repoURL"`
+	SemverConstraint     string   `yaml:"semverConstraint"`
+	TagSelectionStrategy string   `yaml:"tagSelectionStrategy"`
+	Platforms            []string `yaml:"platforms"`
+	DiscoveryLimit       int      `yaml:"discoveryLimit"`
+}
+
+// ChartSubscription is a Helm chart Warehouse subscription.
+type ChartSubscription struct {
+	RepoURL          string `yaml:"repoURL"`
+	Name             string `yaml:"name"`
+	SemverConstraint string `yaml:"semverConstraint"`
+}
+
+// PromotionConfig describes how an app (or one of its stages) promotes
+// between environments. Mode defaults to "direct" (the existing
+// argocd-update-only flow) when omitted, so apps that don't opt in keep
+// generating the same stages.yaml as before.
+type PromotionConfig struct {
+	Mode           string                      `yaml:"mode"`     // "direct" (default) or "pullRequest"
+	Provider       string                      `yaml:"provider"` // "github" or "gitlab"
+	BaseBranch     string                      `yaml:"baseBranch"`
+	PRBranchPrefix string                      `yaml:"prBranchPrefix"`
+	StageOverrides map[string]*PromotionConfig `yaml:"stageOverrides"`
 }
 
 // AppInfo holds information about a discovered app
@@ -37,6 +134,164 @@ type AppInfo struct {
 	Type           string // "workloads" or "infra"
 	SourcePath     string // e.g., "apps/workloads/simple-echo-server"
 	TargetClusters []string
+	Promotion      *PromotionConfig
+	Subscriptions  *SubscriptionsConfig
+	Pipeline       []PipelineNode
+	Verification   *VerificationConfig
+}
+
+// fsOp abstracts the filesystem mutations this script makes, so a dry-run
+// mode can compute what would change without touching disk.
+type fsOp interface {
+	WriteFile(path string, data []byte, perm os.FileMode) error
+	MkdirAll(path string, perm os.FileMode) error
+	RemoveAll(path string) error
+	Remove(path string) error
+}
+
+// applyFsOp performs filesystem mutations for real.
+type applyFsOp struct{}
+
+func (applyFsOp) WriteFile(path string, data []byte, perm os.FileMode) error {
+	return os.WriteFile(path, data, perm)
+}
+func (applyFsOp) MkdirAll(path string, perm os.FileMode) error { return os.MkdirAll(path, perm) }
+func (applyFsOp) RemoveAll(path string) error                  { return os.RemoveAll(path) }
+func (applyFsOp) Remove(path string) error                     { return os.Remove(path) }
+
+// planFsOp records what would change instead of touching disk, printing a
+// unified diff per file and tracking whether anything changed.
+type planFsOp struct {
+	changed bool
+}
+
+func (p *planFsOp) WriteFile(path string, data []byte, perm os.FileMode) error {
+	existing, err := os.ReadFile(path)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		existing = nil
+	}
+	if string(existing) == string(data) {
+		return nil
+	}
+	p.changed = true
+	fmt.Print(unifiedDiff(path, existing, data))
+	return nil
+}
+
+func (p *planFsOp) MkdirAll(path string, perm os.FileMode) error {
+	if info, err := os.Stat(path); err == nil && info.IsDir() {
+		return nil
+	}
+	p.changed = true
+	fmt.Printf("would create directory %s\n", path)
+	return nil
+}
+
+func (p *planFsOp) RemoveAll(path string) error {
+	if _, err := os.Stat(path); os.IsNotExist(err) {
+		return nil
+	}
+	p.changed = true
+	fmt.Printf("would remove %s\n", path)
+	return nil
+}
+
+func (p *planFsOp) Remove(path string) error {
+	return p.RemoveAll(path)
+}
+
+// unifiedDiff renders a line-based unified diff between oldContent (nil if
+// the file doesn't exist yet) and newContent.
+func unifiedDiff(path string, oldContent, newContent []byte) string {
+	oldLines := strings.Split(string(oldContent), "\n")
+	newLines := strings.Split(string(newContent), "\n")
+	lcs := lcsLines(oldLines, newLines)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s\n+++ %s\n", path, path)
+	oi, ni, li := 0, 0, 0
+	for oi < len(oldLines) || ni < len(newLines) {
+		switch {
+		case li < len(lcs) && oi < len(oldLines) && ni < len(newLines) && oldLines[oi] == lcs[li] && newLines[ni] == lcs[li]:
+			fmt.Fprintf(&b, " %s\n", oldLines[oi])
+			oi++
+			ni++
+			li++
+		case oi < len(oldLines) && (li >= len(lcs) || oldLines[oi] != lcs[li]):
+			fmt.Fprintf(&b, "-%s\n", oldLines[oi])
+			oi++
+		default:
+			fmt.Fprintf(&b, "+%s\n", newLines[ni])
+			ni++
+		}
+	}
+	return b.String()
+}
+
+// lcsLines returns the longest common subsequence of two line slices.
+func lcsLines(a, b []string) []string {
+	n, m := len(a), len(b)
+	dp := make([][]int, n+1)
+	for i := range dp {
+		dp[i] = make([]int, m+1)
+	}
+	for i := n - 1; i >= 0; i-- {
+		for j := m - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				dp[i][j] = dp[i+1][j+1] + 1
+			} else if dp[i+1][j] >= dp[i][j+1] {
+				dp[i][j] = dp[i+1][j]
+			} else {
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+
+	var lcs []string
+	i, j := 0, 0
+	for i < n && j < m {
+		switch {
+		case a[i] == b[j]:
+			lcs = append(lcs, a[i])
+			i++
+			j++
+		case dp[i+1][j] >= dp[i][j+1]:
+			i++
+		default:
+			j++
+		}
+	}
+	return lcs
+}
+
+// resolveStageVerification returns the verification config for a stage,
+// falling back to the "default" entry, or nil if neither is declared.
+func resolveStageVerification(app AppInfo, stageName string) *StageVerification {
+	if app.Verification == nil {
+		return nil
+	}
+	if v, ok := app.Verification.Stages[stageName]; ok {
+		return &v
+	}
+	if v, ok := app.Verification.Stages["default"]; ok {
+		return &v
+	}
+	return nil
+}
+
+// resolvePromotionConfig returns the effective promotion config for a given
+// stage, applying any per-stage override on top of the app-level default.
+func resolvePromotionConfig(app AppInfo, stageName string) *PromotionConfig {
+	if app.Promotion == nil {
+		return nil
+	}
+	if override, ok := app.Promotion.StageOverrides[stageName]; ok && override != nil {
+		return override
+	}
+	return app.Promotion
 }
 
 // CredentialsConfig represents the structure of values-credentials.yaml
@@ -52,6 +307,17 @@ type CredentialsConfig struct {
 }
 
 func main() {
+	dryRun := flag.Bool("dry-run", false, "compute changes without writing to disk, printing a diff; exit 1 if the tree would change")
+	diffOnly := flag.Bool("diff", false, "alias for -dry-run")
+	flag.Parse()
+	planMode := *dryRun || *diffOnly
+
+	var fs fsOp = applyFsOp{}
+	plan := &planFsOp{}
+	if planMode {
+		fs = plan
+	}
+
 	// Find the repo root (where apps/ directory exists)
 	repoRoot, err := findRepoRoot()
 	if err != nil {
@@ -85,24 +351,70 @@ func main() {
 	// Generate Kargo configs directory
 	kargoConfigsDir := filepath.Join(repoRoot, "apps", "kargo-configs")
 
-	// Clean up existing configs
-	if err := os.RemoveAll(kargoConfigsDir); err != nil {
-		fmt.Fprintf(os.Stderr, "Error cleaning up kargo-configs: %v\n", err)
-		os.Exit(1)
+	if planMode {
+		// Don't wipe the directory up front - diff file-by-file instead, and
+		// separately flag app directories that no longer have a matching app.
+		if err := removeStaleKargoConfigs(fs, kargoConfigsDir, apps); err != nil {
+			fmt.Fprintf(os.Stderr, "Error checking for stale kargo-configs: %v\n", err)
+			os.Exit(1)
+		}
+	} else {
+		// Clean up existing configs
+		if err := fs.RemoveAll(kargoConfigsDir); err != nil {
+			fmt.Fprintf(os.Stderr, "Error cleaning up kargo-configs: %v\n", err)
+			os.Exit(1)
+		}
 	}
 
 	// Generate Kargo resources for each app
 	for _, app := range apps {
 		fmt.Printf("\nGenerating Kargo configs for %s/%s...\n", app.Type, app.Name)
-		if err := generateKargoConfigs(kargoConfigsDir, app, gitRepoURL, kargoGitRepoURL); err != nil {
+		if err := generateKargoConfigs(fs, kargoConfigsDir, app, gitRepoURL, kargoGitRepoURL); err != nil {
 			fmt.Fprintf(os.Stderr, "Error generating Kargo configs for %s: %v\n", app.Name, err)
 			os.Exit(1)
 		}
 	}
 
+	if planMode {
+		if plan.changed {
+			fmt.Println("\nTree is out of date.")
+			os.Exit(1)
+		}
+		fmt.Println("\nTree is up to date.")
+		return
+	}
+
 	fmt.Println("\nDone!")
 }
 
+// removeStaleKargoConfigs removes app directories under kargoConfigsDir that
+// no longer correspond to a discovered app, without touching directories
+// that are about to be regenerated.
+func removeStaleKargoConfigs(fs fsOp, kargoConfigsDir string, apps []AppInfo) error {
+	entries, err := os.ReadDir(kargoConfigsDir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	valid := make(map[string]bool, len(apps))
+	for _, app := range apps {
+		valid[app.Name] = true
+	}
+
+	for _, entry := range entries {
+		if !entry.IsDir() || valid[entry.Name()] {
+			continue
+		}
+		if err := fs.RemoveAll(filepath.Join(kargoConfigsDir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // findRepoRoot finds the repository root by looking for the apps/ directory
 func findRepoRoot() (string, error) {
 	dir, err := os.Getwd()
@@ -243,6 +555,10 @@ func discoverAppsInDir(repoRoot, appType string) ([]AppInfo, error) {
 			Type:           appType,
 			SourcePath:     filepath.Join("apps", appType, appName),
 			TargetClusters: config.TargetClusters,
+			Promotion:      config.Promotion,
+			Subscriptions:  config.Subscriptions,
+			Pipeline:       config.Pipeline,
+			Verification:   config.Verification,
 		})
 
 		fmt.Printf("  Found %s/%s targeting %v\n", appType, appName, config.TargetClusters)
@@ -269,38 +585,45 @@ func readAppConfig(path string) (*AppConfig, error) {
 // generateKargoConfigs generates all Kargo resources for an app
 // gitRepoURL: HTTPS URL for ArgoCD references
 // kargoGitRepoURL: SSH URL for Warehouse subscriptions
-func generateKargoConfigs(kargoConfigsDir string, app AppInfo, gitRepoURL string, kargoGitRepoURL string) error {
+func generateKargoConfigs(fs fsOp, kargoConfigsDir string, app AppInfo, gitRepoURL string, kargoGitRepoURL string) error {
 	appDir := filepath.Join(kargoConfigsDir, app.Name)
-	if err := os.MkdirAll(appDir, 0755); err != nil {
+	if err := fs.MkdirAll(appDir, 0755); err != nil {
 		return fmt.Errorf("creating directory: %w", err)
 	}
 
 	// Generate Namespace with Kargo label (allows Kargo to adopt existing namespaces)
-	if err := generateNamespace(appDir, app); err != nil {
+	if err := generateNamespace(fs, appDir, app); err != nil {
 		return fmt.Errorf("generating namespace: %w", err)
 	}
 
 	// Generate Project
-	if err := generateProject(appDir, app); err != nil {
+	if err := generateProject(fs, appDir, app); err != nil {
 		return fmt.Errorf("generating project: %w", err)
 	}
 
 	// Generate Warehouse (uses SSH URL for Git subscription)
-	if err := generateWarehouse(appDir, app, kargoGitRepoURL); err != nil {
+	if err := generateWarehouse(fs, appDir, app, kargoGitRepoURL); err != nil {
 		return fmt.Errorf("generating warehouse: %w", err)
 	}
 
 	// Generate Stages (uses HTTPS URL for ArgoCD updates)
-	if err := generateStages(appDir, app, gitRepoURL); err != nil {
+	if err := generateStages(fs, appDir, app, gitRepoURL); err != nil {
 		return fmt.Errorf("generating stages: %w", err)
 	}
 
+	// Generate AnalysisTemplates the app embeds for verification
+	if app.Verification != nil && len(app.Verification.Templates) > 0 {
+		if err := generateAnalysisTemplates(fs, appDir, app); err != nil {
+			return fmt.Errorf("generating analysis templates: %w", err)
+		}
+	}
+
 	return nil
 }
 
 // generateNamespace generates a Namespace resource with Kargo project label
 // This allows Kargo to adopt existing namespaces that were created by other apps
-func generateNamespace(appDir string, app AppInfo) error {
+func generateNamespace(fs fsOp, appDir string, app AppInfo) error {
 	content := fmt.Sprintf(`# GENERATED - DO NOT EDIT
 # Source: %s/app-config.yaml
 # Run 'go run scripts/generate-kargo-pipelines.go' to regenerate
@@ -317,7 +640,7 @@ metadata:
 `, app.SourcePath, app.Name)
 
 	path := filepath.Join(appDir, "namespace.yaml")
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	if err := fs.WriteFile(path, []byte(content), 0644); err != nil {
 		return err
 	}
 	fmt.Printf("  Generated %s\n", path)
@@ -325,7 +648,7 @@ metadata:
 }
 
 // generateProject generates the Kargo Project resource
-func generateProject(appDir string, app AppInfo) error {
+func generateProject(fs fsOp, appDir string, app AppInfo) error {
 	content := fmt.Sprintf(`# GENERATED - DO NOT EDIT
 # Source: %s/app-config.yaml
 # Run 'go run scripts/generate-kargo-pipelines.go' to regenerate
@@ -336,7 +659,7 @@ metadata:
 `, app.SourcePath, app.Name)
 
 	path := filepath.Join(appDir, "project.yaml")
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	if err := fs.WriteFile(path, []byte(content), 0644); err != nil {
 		return err
 	}
 	fmt.Printf("  Generated %s\n", path)
@@ -344,7 +667,23 @@ metadata:
 }
 
 // generateWarehouse generates the Kargo Warehouse resource
-func generateWarehouse(appDir string, app AppInfo, gitRepoURL string) error {
+func generateWarehouse(fs fsOp, appDir string, app AppInfo, gitRepoURL string) error {
+	var subscriptions strings.Builder
+	subscriptions.WriteString(fmt.Sprintf(`    - git:
+        repoURL: %s
+        includePaths:
+          - %s/**
+`, gitRepoURL, app.SourcePath))
+
+	if app.Subscriptions != nil {
+		for _, img := range app.Subscriptions.Images {
+			subscriptions.WriteString(generateImageSubscriptionYAML(img))
+		}
+		for _, chart := range app.Subscriptions.Charts {
+			subscriptions.WriteString(generateChartSubscriptionYAML(chart))
+		}
+	}
+
 	content := fmt.Sprintf(`# GENERATED - DO NOT EDIT
 # Source: %s/app-config.yaml
 # Run 'go run scripts/generate-kargo-pipelines.go' to regenerate
@@ -355,14 +694,84 @@ metadata:
   namespace: %s
 spec:
   subscriptions:
-    - git:
-        repoURL: %s
-        includePaths:
-          - %s/**
-`, app.SourcePath, app.Name, app.Name, gitRepoURL, app.SourcePath)
+%s`, app.SourcePath, app.Name, app.Name, subscriptions.String())
 
 	path := filepath.Join(appDir, "warehouse.yaml")
-	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+	if err := fs.WriteFile(path, []byte(content), 0644); err != nil {
+		return err
+	}
+	fmt.Printf("  Generated %s\n", path)
+	return nil
+}
+
+// generateImageSubscriptionYAML emits a single image subscription entry.
+func generateImageSubscriptionYAML(img ImageSubscription) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("    - image:\n        repoURL: %s\n", img.RepoURL))
+	if img.SemverConstraint != "" {
+		b.WriteString(fmt.Sprintf("        semverConstraint: %s\n", img.SemverConstraint))
+	}
+	if img.TagSelectionStrategy != "" {
+		b.WriteString(fmt.Sprintf("        tagSelectionStrategy: %s\n", img.TagSelectionStrategy))
+	}
+	if len(img.Platforms) > 0 {
+		b.WriteString("        platforms:\n")
+		for _, p := range img.Platforms {
+			b.WriteString(fmt.Sprintf("          - %s\n", p))
+		}
+	}
+	if img.DiscoveryLimit > 0 {
+		b.WriteString(fmt.Sprintf("        discoveryLimit: %d\n", img.DiscoveryLimit))
+	}
+	return b.String()
+}
+
+// generateChartSubscriptionYAML emits a single Helm chart subscription entry.
+func generateChartSubscriptionYAML(chart ChartSubscription) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("    - chart:\n        repoURL: %s\n", chart.RepoURL))
+	if chart.Name != "" {
+		b.WriteString(fmt.Sprintf("        name: %s\n", chart.Name))
+	}
+	if chart.SemverConstraint != "" {
+		b.WriteString(fmt.Sprintf("        semverConstraint: %s\n", chart.SemverConstraint))
+	}
+	return b.String()
+}
+
+// generateAnalysisTemplates writes a sibling analysis-templates.yaml
+// containing an AnalysisTemplate for each template the app embeds inline
+// under verification.templates, so users can gate promotions on
+// Prometheus/Datadog checks without applying the CR by hand.
+func generateAnalysisTemplates(fs fsOp, appDir string, app AppInfo) error {
+	var content strings.Builder
+	content.WriteString(fmt.Sprintf(`# GENERATED - DO NOT EDIT
+# Source: %s/app-config.yaml
+# Run 'go run scripts/generate-kargo-pipelines.go' to regenerate
+`, app.SourcePath))
+
+	for i, tmpl := range app.Verification.Templates {
+		if i > 0 {
+			content.WriteString("---\n")
+		}
+		doc := map[string]interface{}{
+			"apiVersion": "argoproj.io/v1alpha1",
+			"kind":       "AnalysisTemplate",
+			"metadata": map[string]interface{}{
+				"name":      tmpl.Name,
+				"namespace": app.Name,
+			},
+			"spec": tmpl.Spec,
+		}
+		data, err := yaml.Marshal(doc)
+		if err != nil {
+			return fmt.Errorf("marshaling analysis template %q: %w", tmpl.Name, err)
+		}
+		content.Write(data)
+	}
+
+	path := filepath.Join(appDir, "analysis-templates.yaml")
+	if err := fs.WriteFile(path, []byte(content.String()), 0644); err != nil {
 		return err
 	}
 	fmt.Printf("  Generated %s\n", path)
@@ -370,9 +779,13 @@ spec:
 }
 
 // generateStages generates all Kargo Stage resources for an app
-func generateStages(appDir string, app AppInfo, gitRepoURL string) error {
-	// Build ordered list of stages based on target clusters
-	stages := buildStageOrder(app.TargetClusters)
+func generateStages(fs fsOp, appDir string, app AppInfo, gitRepoURL string) error {
+	// Build ordered list of stages, from the app's declared pipeline graph
+	// if it has one, otherwise the default linear+parallel shape.
+	stages, err := buildStageOrder(app)
+	if err != nil {
+		return fmt.Errorf("building stage order: %w", err)
+	}
 
 	var stagesContent strings.Builder
 	stagesContent.WriteString(fmt.Sprintf(`# GENERATED - DO NOT EDIT
@@ -391,15 +804,110 @@ func generateStages(appDir string, app AppInfo, gitRepoURL string) error {
 	}
 
 	path := filepath.Join(appDir, "stages.yaml")
-	if err := os.WriteFile(path, []byte(stagesContent.String()), 0644); err != nil {
+	if err := fs.WriteFile(path, []byte(stagesContent.String()), 0644); err != nil {
 		return err
 	}
 	fmt.Printf("  Generated %s\n", path)
 	return nil
 }
 
-// buildStageOrder returns the ordered list of stages for the app based on target clusters
-func buildStageOrder(targetClusters []string) []StageInfo {
+// buildStageOrder returns the ordered list of stages for the app. If the app
+// declares a pipeline:, it's resolved as a DAG (validated, topologically
+// sorted, ties broken alphabetically for diff-stable output). Otherwise the
+// legacy targetClusters list is lowered into the default linear+parallel
+// graph, preserving today's behavior.
+func buildStageOrder(app AppInfo) ([]StageInfo, error) {
+	if len(app.Pipeline) > 0 {
+		return resolvePipelineGraph(app.Pipeline)
+	}
+	return buildDefaultStageOrder(app.TargetClusters), nil
+}
+
+// resolvePipelineGraph validates and topologically sorts a declarative
+// pipeline graph, returning stages in deterministic order with their
+// resolved upstreams.
+func resolvePipelineGraph(nodes []PipelineNode) ([]StageInfo, error) {
+	byName := make(map[string]PipelineNode, len(nodes))
+	for _, n := range nodes {
+		if _, exists := byName[n.Name]; exists {
+			return nil, fmt.Errorf("duplicate pipeline stage name %q", n.Name)
+		}
+		byName[n.Name] = n
+	}
+
+	for _, n := range nodes {
+		for _, after := range n.After {
+			if _, ok := byName[after]; !ok {
+				return nil, fmt.Errorf("pipeline stage %q references unknown upstream %q", n.Name, after)
+			}
+		}
+	}
+
+	var order []string
+	visiting := make(map[string]bool)
+	visited := make(map[string]bool)
+
+	var names []string
+	for name := range byName {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var visit func(name string) error
+	visit = func(name string) error {
+		if visited[name] {
+			return nil
+		}
+		if visiting[name] {
+			return fmt.Errorf("pipeline has a cycle involving stage %q", name)
+		}
+		visiting[name] = true
+
+		upstreams := append([]string(nil), byName[name].After...)
+		sort.Strings(upstreams)
+		for _, after := range upstreams {
+			if err := visit(after); err != nil {
+				return err
+			}
+		}
+
+		visiting[name] = false
+		visited[name] = true
+		order = append(order, name)
+		return nil
+	}
+
+	for _, name := range names {
+		if err := visit(name); err != nil {
+			return nil, err
+		}
+	}
+
+	stages := make([]StageInfo, 0, len(order))
+	for _, name := range order {
+		node := byName[name]
+		upstreams := append([]string(nil), node.After...)
+		sort.Strings(upstreams)
+		// Shard falls back to the stage's target cluster (so a stage named
+		// differently from the cluster it promotes to, e.g. a "canary" stage
+		// fanning in from prod-us, still routes to the right Kargo agent)
+		// before generateStageYAML's own fallback to the stage name.
+		shard := node.Shard
+		if shard == "" {
+			shard = node.Cluster
+		}
+		stages = append(stages, StageInfo{
+			Name:      node.Name,
+			Shard:     shard,
+			Upstreams: upstreams,
+		})
+	}
+	return stages, nil
+}
+
+// buildDefaultStageOrder returns the ordered list of stages for the app
+// based on target clusters, using the hardcoded two-tier pipeline shape.
+func buildDefaultStageOrder(targetClusters []string) []StageInfo {
 	var stages []StageInfo
 	clusterSet := make(map[string]bool)
 	for _, c := range targetClusters {
@@ -422,8 +930,9 @@ func buildStageOrder(targetClusters []string) []StageInfo {
 				}
 			}
 			stages = append(stages, StageInfo{
-				Name:     cluster,
-				Upstream: upstream,
+				Name:      cluster,
+				Upstreams: upstreamsOf(upstream),
+				Shard:     cluster,
 			})
 		}
 	}
@@ -448,24 +957,35 @@ func buildStageOrder(targetClusters []string) []StageInfo {
 
 	for _, cluster := range parallelToAdd {
 		stages = append(stages, StageInfo{
-			Name:     cluster,
-			Upstream: lastSequential,
+			Name:      cluster,
+			Upstreams: upstreamsOf(lastSequential),
+			Shard:     cluster,
 		})
 	}
 
 	return stages
 }
 
+// upstreamsOf wraps a single upstream name into the []string form StageInfo
+// expects, or returns nil for "pull directly from warehouse".
+func upstreamsOf(upstream string) []string {
+	if upstream == "" {
+		return nil
+	}
+	return []string{upstream}
+}
+
 // StageInfo holds information about a stage
 type StageInfo struct {
-	Name     string
-	Upstream string // Empty means get from warehouse directly
+	Name      string
+	Shard     string   // Shard to run the promotion process on; empty falls back to the stage name
+	Upstreams []string // Empty means get from warehouse directly; multiple means fan-in
 }
 
 // generateStageYAML generates the YAML for a single stage
 func generateStageYAML(app AppInfo, stage StageInfo, gitRepoURL string) string {
 	var requestedFreight string
-	if stage.Upstream == "" {
+	if len(stage.Upstreams) == 0 {
 		// First stage - get directly from warehouse
 		requestedFreight = fmt.Sprintf(`  requestedFreight:
     - origin:
@@ -474,14 +994,34 @@ func generateStageYAML(app AppInfo, stage StageInfo, gitRepoURL string) string {
       sources:
         direct: true`, app.Name)
 	} else {
-		// Downstream stage - get from upstream stage
+		// Downstream stage - get from one or more upstream stages (fan-in)
+		var upstreams strings.Builder
+		for _, u := range stage.Upstreams {
+			upstreams.WriteString(fmt.Sprintf("          - %s\n", u))
+		}
 		requestedFreight = fmt.Sprintf(`  requestedFreight:
     - origin:
         kind: Warehouse
         name: %s
       sources:
         stages:
-          - %s`, app.Name, stage.Upstream)
+%s`, app.Name, strings.TrimSuffix(upstreams.String(), "\n"))
+	}
+
+	shard := stage.Shard
+	if shard == "" {
+		shard = stage.Name
+	}
+
+	verification := generateVerificationYAML(resolveStageVerification(app, stage.Name))
+
+	promotion := resolvePromotionConfig(app, stage.Name)
+
+	var steps string
+	if promotion != nil && promotion.Mode == "pullRequest" {
+		steps = generatePullRequestPromotionSteps(app, stage, gitRepoURL, promotion)
+	} else {
+		steps = generateDirectPromotionSteps(app, gitRepoURL)
 	}
 
 	return fmt.Sprintf(`apiVersion: kargo.akuity.io/v1alpha1
@@ -492,21 +1032,185 @@ metadata:
 spec:
   shard: %s
 %s
-  promotionTemplate:
+%s  promotionTemplate:
     spec:
       steps:
-        - uses: git-clone
+%s`, stage.Name, app.Name, shard, requestedFreight, verification, steps)
+}
+
+// generateVerificationYAML emits the spec.verification block for a stage, or
+// an empty string when the stage has no verification configured.
+func generateVerificationYAML(v *StageVerification) string {
+	if v == nil || len(v.Templates) == 0 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteString("  verification:\n    analysisTemplates:\n")
+	for _, tmpl := range v.Templates {
+		b.WriteString(fmt.Sprintf("      - name: %s\n", tmpl.Name))
+		if tmpl.Namespace != "" {
+			b.WriteString(fmt.Sprintf("        namespace: %s\n", tmpl.Namespace))
+		}
+	}
+	if len(v.Templates) > 0 && hasArgs(v.Templates) {
+		b.WriteString("    args:\n")
+		for _, tmpl := range v.Templates {
+			for _, arg := range tmpl.Args {
+				b.WriteString(fmt.Sprintf("      - name: %s\n        value: %s\n", arg.Name, arg.Value))
+			}
+		}
+	}
+	if v.AnalysisRunMetadata != nil {
+		b.WriteString("    analysisRunMetadata:\n")
+		if len(v.AnalysisRunMetadata.Labels) > 0 {
+			b.WriteString("      labels:\n")
+			for _, k := range sortedKeys(v.AnalysisRunMetadata.Labels) {
+				b.WriteString(fmt.Sprintf("        %s: %s\n", k, v.AnalysisRunMetadata.Labels[k]))
+			}
+		}
+		if len(v.AnalysisRunMetadata.Annotations) > 0 {
+			b.WriteString("      annotations:\n")
+			for _, k := range sortedKeys(v.AnalysisRunMetadata.Annotations) {
+				b.WriteString(fmt.Sprintf("        %s: %s\n", k, v.AnalysisRunMetadata.Annotations[k]))
+			}
+		}
+	}
+	return b.String()
+}
+
+// hasArgs reports whether any of the given template refs carry args.
+func hasArgs(refs []AnalysisTemplateRef) bool {
+	for _, r := range refs {
+		if len(r.Args) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// sortedKeys returns the keys of a string map in sorted order, for
+// deterministic YAML output.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// generateDirectPromotionSteps emits the existing git-clone + argocd-update
+// flow used when a stage has no promotion block (or mode: direct). When the
+// app subscribes to container images, a kustomize-set-image step is inserted
+// beforehand so the discovered tag/digest is written into the chart path.
+func generateDirectPromotionSteps(app AppInfo, gitRepoURL string) string {
+	var steps strings.Builder
+	steps.WriteString(fmt.Sprintf(`        - uses: git-clone
           config:
             repoURL: %s
             checkout:
               - fromFreight: true
                 path: ./src
-        - uses: argocd-update
+`, gitRepoURL))
+
+	if app.Subscriptions != nil && len(app.Subscriptions.Images) > 0 {
+		steps.WriteString(fmt.Sprintf("        - uses: kustomize-set-image\n          config:\n            path: ./src/%s\n            images:\n", app.SourcePath))
+		for _, img := range app.Subscriptions.Images {
+			field := "Tag"
+			if img.TagSelectionStrategy == "Digest" {
+				field = "Digest"
+			}
+			steps.WriteString(fmt.Sprintf("              - image: %s\n                %s: ${{ imageFrom(\"%s\").%s }}\n", img.RepoURL, strings.ToLower(field), img.RepoURL, field))
+		}
+	}
+
+	steps.WriteString(fmt.Sprintf(`        - uses: argocd-update
           config:
             apps:
               - name: %s
                 sources:
                   - repoURL: %s
                     desiredCommitFromStep: ${{ outputs['git-clone'].commit }}
-`, stage.Name, app.Name, stage.Name, requestedFreight, gitRepoURL, app.Name, gitRepoURL)
+`, app.Name, gitRepoURL))
+
+	return steps.String()
+}
+
+// generatePullRequestPromotionSteps emits Kargo's PR-based promotion flow:
+// clone, set image tags/digests in the chart path (only when the app
+// subscribes to images), commit and push to a PR branch, open a PR, wait for
+// it to merge, then sync Argo CD.
+// This mirrors the render/PR flow Kargo itself wires in ahead of argocd-update.
+func generatePullRequestPromotionSteps(app AppInfo, stage StageInfo, gitRepoURL string, promotion *PromotionConfig) string {
+	baseBranch := promotion.BaseBranch
+	if baseBranch == "" {
+		baseBranch = "main"
+	}
+	branchPrefix := promotion.PRBranchPrefix
+	if branchPrefix == "" {
+		branchPrefix = "kargo"
+	}
+	prBranch := fmt.Sprintf("%s/%s/${{ ctx.promotion }}", branchPrefix, stage.Name)
+
+	var steps strings.Builder
+	steps.WriteString(fmt.Sprintf(`        - uses: git-clone
+          config:
+            repoURL: %s
+            checkout:
+              - branch: %s
+                path: ./src
+              - fromFreight: true
+                path: ./src/freight
+        - uses: git-clear
+          config:
+            path: ./src
+`, gitRepoURL, baseBranch))
+
+	if app.Subscriptions != nil && len(app.Subscriptions.Images) > 0 {
+		steps.WriteString(fmt.Sprintf("        - uses: kustomize-set-image\n          config:\n            path: ./src/%s\n            images:\n", app.SourcePath))
+		for _, img := range app.Subscriptions.Images {
+			field := "Tag"
+			if img.TagSelectionStrategy == "Digest" {
+				field = "Digest"
+			}
+			steps.WriteString(fmt.Sprintf("              - image: %s\n                %s: ${{ imageFrom(\"%s\").%s }}\n", img.RepoURL, strings.ToLower(field), img.RepoURL, field))
+		}
+	}
+
+	steps.WriteString(fmt.Sprintf(`        - uses: git-commit
+          as: commit
+          config:
+            path: ./src
+            message: promote %s to %s
+        - uses: git-push
+          config:
+            path: ./src
+            targetBranch: %s
+        - uses: git-open-pr
+          as: open-pr
+          config:
+            repoURL: %s
+            provider: %s
+            createTargetBranch: true
+            sourceBranch: %s
+            targetBranch: %s
+        - uses: git-wait-for-pr
+          config:
+            repoURL: %s
+            provider: %s
+            prNumberFromStep: open-pr
+        - uses: argocd-update
+          config:
+            apps:
+              - name: %s
+                sources:
+                  - repoURL: %s
+                    desiredCommitFromStep: commit
+`, app.Name, stage.Name,
+		prBranch,
+		gitRepoURL, promotion.Provider, prBranch, baseBranch,
+		gitRepoURL, promotion.Provider, app.Name, gitRepoURL))
+
+	return steps.String()
 }